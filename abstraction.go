@@ -0,0 +1,69 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+// StateAbstraction maps TLC states to coarser abstract states, so that
+// states differing only in irrelevant details count as the same state.
+// Variables projects the state onto the listed variables, all variables are
+// kept if empty. Ignore drops variables, such as message bags. Buckets maps
+// the integers in the values of a variable, such as terms and indices, to
+// buckets of the given width.
+type StateAbstraction struct {
+	Name      string
+	Variables []string
+	Ignore    []string
+	Buckets   map[string]int
+}
+
+// Key returns the fingerprint of the abstract state
+func (a StateAbstraction) Key(state map[string]*TLAValue) uint64 {
+	names := a.Variables
+	if len(names) == 0 {
+		names = make([]string, 0, len(state))
+		for name := range state {
+			names = append(names, name)
+		}
+	}
+	ignored := make(map[string]bool)
+	for _, name := range a.Ignore {
+		ignored[name] = true
+	}
+
+	sorted := make([]string, 0, len(names))
+	for _, name := range names {
+		if !ignored[name] {
+			sorted = append(sorted, name)
+		}
+	}
+	sort.Strings(sorted)
+
+	h := fnv.New64a()
+	for _, name := range sorted {
+		value := state[name]
+		if width, ok := a.Buckets[name]; ok && width > 0 {
+			value = bucketValue(value, width)
+		}
+		h.Write([]byte(name + "=" + value.String() + ";"))
+	}
+	return h.Sum64()
+}
+
+// bucketValue maps the integers in a value to buckets of the given width. The
+// keys of functions are left untouched so that node identifiers are kept.
+func bucketValue(value *TLAValue, width int) *TLAValue {
+	if value == nil {
+		return nil
+	}
+	if value.Kind == TLAInt {
+		return &TLAValue{Kind: TLAInt, Int: value.Int / width}
+	}
+	bucketed := *value
+	bucketed.Elems = make([]*TLAValue, len(value.Elems))
+	for i, e := range value.Elems {
+		bucketed.Elems[i] = bucketValue(e, width)
+	}
+	return &bucketed
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Constant pool tags
+const (
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+// classFile holds the parts of a Java class file needed to place JaCoCo's probes
+type classFile struct {
+	access     int
+	name       string
+	superName  string
+	sourceFile string
+	methods    []*methodInfo
+	constants  []constant
+}
+
+// constant is a constant pool entry. Strings hold the value of Utf8 entries,
+// refs the indices of the entries other entries refer to.
+type constant struct {
+	tag  byte
+	str  string
+	refs [2]int
+}
+
+type methodInfo struct {
+	access int
+	name   string
+	desc   string
+	// Bytecode, nil for abstract and native methods
+	code     []byte
+	handlers []exceptionHandler
+	lines    []lineNumber
+	// Offsets referenced by local variable tables
+	debugLabels []int
+}
+
+type exceptionHandler struct {
+	start, end, handler int
+}
+
+type lineNumber struct {
+	offset int
+	line   int
+}
+
+// classReader reads big endian values, recording the first read past the end
+type classReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *classReader) bytes(n int) []byte {
+	if r.err != nil || n < 0 || r.pos+n > len(r.b) {
+		if r.err == nil {
+			r.err = fmt.Errorf("unexpected end of class file at %d", r.pos)
+		}
+		return make([]byte, n)
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *classReader) skip(n int) {
+	r.bytes(n)
+}
+
+func (r *classReader) u1() int {
+	return int(r.bytes(1)[0])
+}
+
+func (r *classReader) u2() int {
+	return int(binary.BigEndian.Uint16(r.bytes(2)))
+}
+
+func (r *classReader) u4() uint32 {
+	return binary.BigEndian.Uint32(r.bytes(4))
+}
+
+func parseClassFile(b []byte) (*classFile, error) {
+	r := &classReader{b: b}
+	if magic := r.u4(); magic != 0xCAFEBABE {
+		return nil, fmt.Errorf("invalid class file magic number %#x", magic)
+	}
+	r.skip(4)
+
+	c := &classFile{constants: make([]constant, r.u2())}
+	for i := 1; i < len(c.constants) && r.err == nil; i++ {
+		tag := byte(r.u1())
+		entry := constant{tag: tag}
+		switch tag {
+		case constantUtf8:
+			entry.str = string(r.bytes(r.u2()))
+		case constantClass, constantString, constantMethodType, constantModule, constantPackage:
+			entry.refs[0] = r.u2()
+		case constantFieldref, constantMethodref, constantInterfaceMethodref, constantNameAndType, constantDynamic, constantInvokeDynamic:
+			entry.refs[0], entry.refs[1] = r.u2(), r.u2()
+		case constantInteger, constantFloat:
+			r.skip(4)
+		case constantLong, constantDouble:
+			r.skip(8)
+		case constantMethodHandle:
+			r.skip(3)
+		default:
+			return nil, fmt.Errorf("invalid constant pool tag %d", tag)
+		}
+		c.constants[i] = entry
+		// Longs and doubles take two entries
+		if tag == constantLong || tag == constantDouble {
+			i++
+		}
+	}
+
+	c.access = r.u2()
+	c.name = c.className(r.u2())
+	c.superName = c.className(r.u2())
+	r.skip(2 * r.u2())
+
+	fields := r.u2()
+	for i := 0; i < fields && r.err == nil; i++ {
+		r.skip(6)
+		c.skipAttributes(r)
+	}
+
+	c.methods = make([]*methodInfo, r.u2())
+	for i := range c.methods {
+		m := &methodInfo{access: r.u2(), name: c.utf8(r.u2()), desc: c.utf8(r.u2())}
+		attributes := r.u2()
+		for j := 0; j < attributes && r.err == nil; j++ {
+			name := c.utf8(r.u2())
+			attribute := r.bytes(int(r.u4()))
+			if name == "Code" {
+				if err := c.parseCode(m, attribute); err != nil {
+					return nil, err
+				}
+			}
+		}
+		c.methods[i] = m
+	}
+
+	attributes := r.u2()
+	for i := 0; i < attributes && r.err == nil; i++ {
+		name := c.utf8(r.u2())
+		attribute := &classReader{b: r.bytes(int(r.u4()))}
+		if name == "SourceFile" {
+			c.sourceFile = c.utf8(attribute.u2())
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return c, nil
+}
+
+func (c *classFile) skipAttributes(r *classReader) {
+	attributes := r.u2()
+	for i := 0; i < attributes && r.err == nil; i++ {
+		r.skip(2)
+		r.skip(int(r.u4()))
+	}
+}
+
+// parseCode reads the bytecode, exception table and debug information of a Code attribute
+func (c *classFile) parseCode(m *methodInfo, attribute []byte) error {
+	r := &classReader{b: attribute}
+	r.skip(4)
+	m.code = r.bytes(int(r.u4()))
+
+	handlers := r.u2()
+	m.handlers = make([]exceptionHandler, 0, handlers)
+	for i := 0; i < handlers && r.err == nil; i++ {
+		m.handlers = append(m.handlers, exceptionHandler{start: r.u2(), end: r.u2(), handler: r.u2()})
+		r.skip(2)
+	}
+
+	m.lines = make([]lineNumber, 0)
+	m.debugLabels = make([]int, 0)
+	attributes := r.u2()
+	for i := 0; i < attributes && r.err == nil; i++ {
+		name := c.utf8(r.u2())
+		table := &classReader{b: r.bytes(int(r.u4()))}
+		switch name {
+		case "LineNumberTable":
+			entries := table.u2()
+			for j := 0; j < entries && table.err == nil; j++ {
+				offset, line := table.u2(), table.u2()
+				if offset < len(m.code) {
+					m.lines = append(m.lines, lineNumber{offset: offset, line: line})
+				}
+			}
+		case "LocalVariableTable", "LocalVariableTypeTable":
+			entries := table.u2()
+			for j := 0; j < entries && table.err == nil; j++ {
+				start, length := table.u2(), table.u2()
+				table.skip(6)
+				for _, offset := range []int{start, start + length} {
+					if offset <= len(m.code) {
+						m.debugLabels = append(m.debugLabels, offset)
+					}
+				}
+			}
+		}
+		if table.err != nil {
+			return table.err
+		}
+	}
+	for _, h := range m.handlers {
+		if h.start > len(m.code) || h.end > len(m.code) || h.handler >= len(m.code) {
+			return fmt.Errorf("exception handler out of range in %s", m.name)
+		}
+	}
+	return r.err
+}
+
+func (c *classFile) utf8(index int) string {
+	if index <= 0 || index >= len(c.constants) {
+		return ""
+	}
+	return c.constants[index].str
+}
+
+func (c *classFile) className(index int) string {
+	if index <= 0 || index >= len(c.constants) {
+		return ""
+	}
+	return c.utf8(c.constants[index].refs[0])
+}
+
+// methodRef returns the owner, name and descriptor of a method reference
+func (c *classFile) methodRef(index int) (string, string, string) {
+	if index <= 0 || index >= len(c.constants) || c.constants[index].tag != constantMethodref {
+		return "", "", ""
+	}
+	ref := c.constants[index].refs
+	if ref[1] <= 0 || ref[1] >= len(c.constants) {
+		return "", "", ""
+	}
+	nameAndType := c.constants[ref[1]].refs
+	return c.className(ref[0]), c.utf8(nameAndType[0]), c.utf8(nameAndType[1])
+}
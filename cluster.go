@@ -40,6 +40,7 @@ type NodeConfig struct {
 	NumNodes        int
 	LogConfig       string
 	PeerAddresses   string
+	JavaToolOptions string
 }
 
 type ClusterConfig struct {
@@ -59,6 +60,13 @@ type ClusterConfig struct {
 	WorkDir             string
 	RatisDataDir        string
 	LogLevel            string
+	// JaCoCo agent attached to the Java processes, nil disables code coverage
+	Jacoco *JacocoAgentConfig
+	// Exec file the JaCoCo agents write to instead of Jacoco.DestFile if set
+	JacocoExecFile string
+	// Code coverage of each server type, DefaultCodeCoverageConfig if nil
+	XraftCoverage *CodeCoverageConfig
+	RatisCoverage *CodeCoverageConfig
 }
 
 func (c *ClusterConfig) Copy() *ClusterConfig {
@@ -77,6 +85,10 @@ func (c *ClusterConfig) Copy() *ClusterConfig {
 		WorkDir:             c.WorkDir,
 		RatisDataDir:        c.RatisDataDir,
 		LogLevel:            c.LogLevel,
+		Jacoco:              c.Jacoco,
+		JacocoExecFile:      c.JacocoExecFile,
+		XraftCoverage:       c.XraftCoverage,
+		RatisCoverage:       c.RatisCoverage,
 	}
 }
 
@@ -99,6 +111,37 @@ func (c *ClusterConfig) SetDefaults() {
 	}
 }
 
+// CodeCoverage returns the code coverage configuration of the server type
+func (c *ClusterConfig) CodeCoverage() *CodeCoverageConfig {
+	coverage := c.XraftCoverage
+	if c.ServerType == Ratis {
+		coverage = c.RatisCoverage
+	}
+	if coverage == nil {
+		coverage = DefaultCodeCoverageConfig(c.ServerType)
+	}
+	return coverage
+}
+
+// javaToolOptions returns the JAVA_TOOL_OPTIONS of the node or client processes
+func (c *ClusterConfig) javaToolOptions(client bool) string {
+	if c.Jacoco == nil || (client && !c.Jacoco.InstrumentClient) {
+		return ""
+	}
+	return c.Jacoco.Options(c.JacocoExecFile, c.CodeCoverage())
+}
+
+// execFile returns the exec file the JaCoCo agents of the nodes write to
+func (c *ClusterConfig) execFile() string {
+	if c.Jacoco == nil {
+		return ""
+	}
+	if c.JacocoExecFile != "" {
+		return c.JacocoExecFile
+	}
+	return c.Jacoco.DestFile
+}
+
 func (c *ClusterConfig) GetNodeConfig(id string, nodeType NodeType) *NodeConfig {
 	nodeWorkDir := path.Join(c.WorkDir, id)
 	if _, err := os.Stat(nodeWorkDir); err == nil {
@@ -139,6 +182,7 @@ func (c *ClusterConfig) GetNodeConfig(id string, nodeType NodeType) *NodeConfig
 		NumNodes:        c.NumNodes,
 		LogConfig:       logConfig,
 		PeerAddresses:   peerAddresses,
+		JavaToolOptions: c.javaToolOptions(false),
 	}
 }
 
@@ -153,14 +197,14 @@ func NewCluster(config *ClusterConfig, logger *Logger) *Cluster {
 	config.SetDefaults()
 	var client Client
 	if config.ServerType == Xraft {
-		client = NewXraftClient(config.NumNodes, config.BaseServicePort, config.XraftClientPath, logger)
+		client = NewXraftClient(config.NumNodes, config.BaseServicePort, config.XraftClientPath, config.javaToolOptions(true), logger)
 	} else {
 		peerAddresses := ""
 		for i := 0; i < config.NumNodes; i++ {
 			peerAddresses += "127.0.0.1:" + strconv.Itoa(config.BaseGroupPort+i) + ","
 		}
 		peerAddresses = peerAddresses[:len(peerAddresses)-1]
-		client = NewRatisClient(config.RatisClientPath, peerAddresses, config.RatisLog4jConfig, logger)
+		client = NewRatisClient(config.RatisClientPath, peerAddresses, config.RatisLog4jConfig, config.javaToolOptions(true), logger)
 	}
 
 	c := &Cluster{
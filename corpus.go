@@ -0,0 +1,43 @@
+package main
+
+// CorpusEntry is an executed schedule together with the code coverage probes it hit
+type CorpusEntry struct {
+	Iteration int
+	Trace     *Trace
+	Probes    []Probe `json:"-"`
+	NumProbes int
+}
+
+// MinimizeCorpus selects a subset of the entries that hits all probes hit by
+// any entry. It greedily takes the entry hitting the most probes not hit by
+// the entries taken so far, preferring earlier entries on ties.
+func MinimizeCorpus(entries []*CorpusEntry) []*CorpusEntry {
+	covered := make(map[Probe]bool)
+	selected := make([]*CorpusEntry, 0)
+	taken := make([]bool, len(entries))
+	for {
+		best, bestGain := -1, 0
+		for i, e := range entries {
+			if taken[i] {
+				continue
+			}
+			gain := 0
+			for _, p := range e.Probes {
+				if !covered[p] {
+					gain++
+				}
+			}
+			if gain > bestGain {
+				best, bestGain = i, gain
+			}
+		}
+		if best < 0 {
+			return selected
+		}
+		taken[best] = true
+		selected = append(selected, entries[best])
+		for _, p := range entries[best].Probes {
+			covered[p] = true
+		}
+	}
+}
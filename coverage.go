@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CodeCoverageConfig configures code coverage for a server type. The class
+// and source directories are passed to the JaCoCo report, the include and
+// exclude patterns (e.g. "org.apache.ratis.*") to the JaCoCo agent.
+type CodeCoverageConfig struct {
+	ClassDirs  []string
+	SourceDirs []string
+	Includes   []string
+	Excludes   []string
+}
+
+// DefaultCodeCoverageConfig returns the code coverage configuration for the
+// server type built next to this repository
+func DefaultCodeCoverageConfig(serverType NodeType) *CodeCoverageConfig {
+	if serverType == Ratis {
+		config := &CodeCoverageConfig{
+			ClassDirs:  make([]string, 0),
+			SourceDirs: make([]string, 0),
+			Includes:   []string{"org.apache.ratis.*"},
+			Excludes:   []string{"org.apache.ratis.thirdparty.*"},
+		}
+		for _, module := range []string{"ratis-common", "ratis-client", "ratis-server-api", "ratis-server", "ratis-grpc", "ratis-examples"} {
+			config.ClassDirs = append(config.ClassDirs, "../ratis-fuzzing/"+module+"/target/classes")
+			config.SourceDirs = append(config.SourceDirs, "../ratis-fuzzing/"+module+"/src/main/java")
+		}
+		return config
+	}
+	return &CodeCoverageConfig{
+		ClassDirs: []string{
+			"../xraft-controlled/xraft-core/target/classes",
+			"../xraft-controlled/xraft-kvstore/target/classes",
+		},
+		SourceDirs: []string{
+			"../xraft-controlled/xraft-core/src/main/java",
+			"../xraft-controlled/xraft-kvstore/src/main/java",
+		},
+		Includes: make([]string, 0),
+		Excludes: make([]string, 0),
+	}
+}
+
+// JacocoAgentConfig configures the JaCoCo agent attached to every Java
+// process the cluster launches
+type JacocoAgentConfig struct {
+	// Path of jacocoagent.jar
+	AgentJar string
+	// Exec file the agents write to unless coverage is recorded per iteration
+	DestFile string
+	// Class name patterns to instrument, the filters of the server type if empty
+	Includes []string
+	Excludes []string
+	// Whether client processes are instrumented in addition to the nodes
+	InstrumentClient bool
+}
+
+// Options returns the JAVA_TOOL_OPTIONS attaching the agent writing to
+// execFile, or to DestFile if empty
+func (a *JacocoAgentConfig) Options(execFile string, coverage *CodeCoverageConfig) string {
+	if execFile == "" {
+		execFile = a.DestFile
+	}
+	jar, err := filepath.Abs(a.AgentJar)
+	if err != nil {
+		jar = a.AgentJar
+	}
+	destFile, err := filepath.Abs(execFile)
+	if err != nil {
+		destFile = execFile
+	}
+	options := fmt.Sprintf("-javaagent:%s=output=file,destfile=%s,append=true,dumponexit=true", jar, destFile)
+
+	includes, excludes := a.Includes, a.Excludes
+	if len(includes) == 0 && coverage != nil {
+		includes = coverage.Includes
+	}
+	if len(excludes) == 0 && coverage != nil {
+		excludes = coverage.Excludes
+	}
+	if len(includes) > 0 {
+		options += ",includes=" + strings.Join(includes, ":")
+	}
+	if len(excludes) > 0 {
+		options += ",excludes=" + strings.Join(excludes, ":")
+	}
+	return options
+}
+
+// javaEnv returns the environment of a Java process with the tool options set
+func javaEnv(toolOptions string) []string {
+	env := os.Environ()
+	if toolOptions != "" {
+		env = append(env, "JAVA_TOOL_OPTIONS="+toolOptions)
+	}
+	return env
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SaveCoverageReports writes the code covered so far as path.lcov and
+// path.cobertura.xml. Source files are looked up in the source directories.
+func SaveCoverageReports(path string, sourceDirs []string) error {
+	for ext, write := range map[string]func(io.Writer, []string) error{
+		".lcov":          WriteLCOV,
+		".cobertura.xml": WriteCobertura,
+	} {
+		file, err := os.Create(path + ext)
+		if err != nil {
+			return err
+		}
+		err = write(file, sourceDirs)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("error writing %s: %s", path+ext, err)
+		}
+	}
+	return nil
+}
+
+func sortedFiles() []string {
+	files := make([]string, 0, len(lineData))
+	for file := range lineData {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func sortedLines(lines map[int][]Branch) []int {
+	numbers := make([]int, 0, len(lines))
+	for n := range lines {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+	return numbers
+}
+
+// sourcePath returns the path of the file in the first source directory containing it
+func sourcePath(file string, sourceDirs []string) string {
+	for _, dir := range sourceDirs {
+		p := filepath.Join(dir, file)
+		if _, err := os.Stat(p); err == nil {
+			if abs, err := filepath.Abs(p); err == nil {
+				return abs
+			}
+			return p
+		}
+	}
+	return file
+}
+
+// WriteLCOV writes the covered lines and branches in the LCOV format. Lines
+// are grouped into tests named after the iteration that first covered them,
+// lines that were never covered are listed under an unnamed test. Branches
+// are taken if their probes fired, every instruction with several branches
+// is a block of its line.
+func WriteLCOV(w io.Writer, sourceDirs []string) error {
+	// Lines of each file grouped by the iteration that first covered them, -1 if never covered
+	groups := make(map[int]map[string][]int)
+	for file, lines := range lineData {
+		for n := range lines {
+			iteration, covered := coverageData[file][n]
+			if !covered {
+				iteration = -1
+			}
+			if _, ok := groups[iteration]; !ok {
+				groups[iteration] = make(map[string][]int)
+			}
+			groups[iteration][file] = append(groups[iteration][file], n)
+		}
+	}
+	iterations := make([]int, 0, len(groups))
+	for iteration := range groups {
+		iterations = append(iterations, iteration)
+	}
+	sort.Ints(iterations)
+
+	b := bufio.NewWriter(w)
+	for _, iteration := range iterations {
+		name := ""
+		if iteration >= 0 {
+			name = fmt.Sprintf("iteration_%d", iteration)
+		}
+		fmt.Fprintf(b, "TN:%s\n", name)
+		for _, file := range sortedFiles() {
+			lines, ok := groups[iteration][file]
+			if !ok {
+				continue
+			}
+			sort.Ints(lines)
+			hit := 0
+			if iteration >= 0 {
+				hit = 1
+			}
+			fmt.Fprintf(b, "SF:%s\n", sourcePath(file, sourceDirs))
+			branches, branchesHit := 0, 0
+			for _, n := range lines {
+				blocks := make(map[string]int)
+				for _, branch := range lineData[file][n] {
+					instruction := fmt.Sprintf("%s:%d", branch.Class, branch.Instruction)
+					block, ok := blocks[instruction]
+					if !ok {
+						block = len(blocks)
+						blocks[instruction] = block
+					}
+					taken := "-"
+					if iteration >= 0 {
+						taken = "0"
+						if branchData[file][n][branch] {
+							taken = "1"
+							branchesHit++
+						}
+					}
+					fmt.Fprintf(b, "BRDA:%d,%d,%d,%s\n", n, block, branch.Index, taken)
+					branches++
+				}
+			}
+			fmt.Fprintf(b, "BRF:%d\nBRH:%d\n", branches, branchesHit)
+			for _, n := range lines {
+				fmt.Fprintf(b, "DA:%d,%d\n", n, hit)
+			}
+			fmt.Fprintf(b, "LF:%d\nLH:%d\n", len(lines), hit*len(lines))
+			fmt.Fprintln(b, "end_of_record")
+		}
+	}
+	return b.Flush()
+}
+
+type cobertura struct {
+	XMLName         xml.Name           `xml:"coverage"`
+	LineRate        string             `xml:"line-rate,attr"`
+	BranchRate      string             `xml:"branch-rate,attr"`
+	LinesCovered    int                `xml:"lines-covered,attr"`
+	LinesValid      int                `xml:"lines-valid,attr"`
+	BranchesCovered int                `xml:"branches-covered,attr"`
+	BranchesValid   int                `xml:"branches-valid,attr"`
+	Complexity      int                `xml:"complexity,attr"`
+	Version         string             `xml:"version,attr"`
+	Timestamp       int64              `xml:"timestamp,attr"`
+	Sources         []string           `xml:"sources>source"`
+	Packages        []coberturaPackage `xml:"packages>package"`
+}
+
+type coberturaPackage struct {
+	Name       string           `xml:"name,attr"`
+	LineRate   string           `xml:"line-rate,attr"`
+	BranchRate string           `xml:"branch-rate,attr"`
+	Complexity int              `xml:"complexity,attr"`
+	Classes    []coberturaClass `xml:"classes>class"`
+}
+
+type coberturaClass struct {
+	Name       string          `xml:"name,attr"`
+	Filename   string          `xml:"filename,attr"`
+	LineRate   string          `xml:"line-rate,attr"`
+	BranchRate string          `xml:"branch-rate,attr"`
+	Complexity int             `xml:"complexity,attr"`
+	Methods    struct{}        `xml:"methods"`
+	Lines      []coberturaLine `xml:"lines>line"`
+}
+
+type coberturaLine struct {
+	Number            int    `xml:"number,attr"`
+	Hits              int    `xml:"hits,attr"`
+	Branch            bool   `xml:"branch,attr"`
+	ConditionCoverage string `xml:"condition-coverage,attr,omitempty"`
+	// Iteration that first covered the line
+	FirstIteration string `xml:"first-iteration,attr,omitempty"`
+}
+
+// coverageCounts counts the lines and branches of the files and how many of them are covered
+type coverageCounts struct {
+	lines, linesCovered, branches, branchesCovered int
+}
+
+func (c *coverageCounts) add(o coverageCounts) {
+	c.lines += o.lines
+	c.linesCovered += o.linesCovered
+	c.branches += o.branches
+	c.branchesCovered += o.branchesCovered
+}
+
+func rate(covered, valid int) string {
+	if valid == 0 {
+		return "1"
+	}
+	return strconv.FormatFloat(float64(covered)/float64(valid), 'f', 4, 64)
+}
+
+// WriteCobertura writes the covered lines and branches in the Cobertura XML
+// format with a class per source file. Covered lines carry the iteration
+// that first covered them in the first-iteration attribute.
+func WriteCobertura(w io.Writer, sourceDirs []string) error {
+	packages := make(map[string]*coberturaPackage)
+	packageCounts := make(map[string]*coverageCounts)
+	total := coverageCounts{}
+	for _, file := range sortedFiles() {
+		class := coberturaClass{
+			Name:     strings.ReplaceAll(strings.TrimSuffix(file, filepath.Ext(file)), "/", "."),
+			Filename: file,
+			Lines:    make([]coberturaLine, 0, len(lineData[file])),
+		}
+		counts := coverageCounts{}
+		for _, n := range sortedLines(lineData[file]) {
+			line := coberturaLine{Number: n}
+			counts.lines++
+			if iteration, ok := coverageData[file][n]; ok {
+				line.Hits = 1
+				line.FirstIteration = strconv.Itoa(iteration)
+				counts.linesCovered++
+			}
+			if branches := len(lineData[file][n]); branches > 0 {
+				covered := len(branchData[file][n])
+				line.Branch = true
+				line.ConditionCoverage = fmt.Sprintf("%d%% (%d/%d)", covered*100/branches, covered, branches)
+				counts.branches += branches
+				counts.branchesCovered += covered
+			}
+			class.Lines = append(class.Lines, line)
+		}
+		class.LineRate = rate(counts.linesCovered, counts.lines)
+		class.BranchRate = rate(counts.branchesCovered, counts.branches)
+
+		name := strings.ReplaceAll(filepath.Dir(file), "/", ".")
+		pkg, ok := packages[name]
+		if !ok {
+			pkg = &coberturaPackage{Name: name, Classes: make([]coberturaClass, 0)}
+			packages[name] = pkg
+			packageCounts[name] = &coverageCounts{}
+		}
+		pkg.Classes = append(pkg.Classes, class)
+		packageCounts[name].add(counts)
+		total.add(counts)
+	}
+
+	doc := cobertura{
+		LineRate:        rate(total.linesCovered, total.lines),
+		BranchRate:      rate(total.branchesCovered, total.branches),
+		LinesCovered:    total.linesCovered,
+		LinesValid:      total.lines,
+		BranchesCovered: total.branchesCovered,
+		BranchesValid:   total.branches,
+		Version:         "modelfuzz",
+		Timestamp:       time.Now().UnixMilli(),
+		Sources:         sourceDirs,
+		Packages:        make([]coberturaPackage, 0, len(packages)),
+	}
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pkg := packages[name]
+		pkg.LineRate = rate(packageCounts[name].linesCovered, packageCounts[name].lines)
+		pkg.BranchRate = rate(packageCounts[name].branchesCovered, packageCounts[name].branches)
+		doc.Packages = append(doc.Packages, *pkg)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	return enc.Encode(doc)
+}
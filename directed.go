@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Operand is one side of a TargetCondition. It is either a literal value or
+// the value of a state variable. Key selects an entry of a function valued
+// variable, where "*" stands for the node the predicate is evaluated on.
+// Length compares the length of a sequence value instead of the value itself.
+type Operand struct {
+	Variable string
+	Key      string
+	Length   bool
+	Literal  string
+}
+
+// TargetCondition compares two operands with one of =, !=, <, <=, >, >=
+type TargetCondition struct {
+	Left  Operand
+	Op    string
+	Right Operand
+}
+
+// TargetPredicate is a conjunction of conditions over the variables of a TLC
+// state. If any operand uses the "*" key the predicate holds when the
+// conditions hold for some node.
+type TargetPredicate struct {
+	Name       string
+	Conditions []TargetCondition
+}
+
+// Distance returns how far the state is from satisfying the predicate. Each
+// unsatisfied numeric condition contributes the difference between its
+// operands and every other unsatisfied condition contributes 1. A distance of
+// 0 means the predicate holds.
+func (p TargetPredicate) Distance(state map[string]*TLAValue) float64 {
+	nodes := make(map[string]bool)
+	for _, c := range p.Conditions {
+		for _, o := range []Operand{c.Left, c.Right} {
+			if o.Key == "*" {
+				for _, k := range state[o.Variable].Domain() {
+					nodes[k] = true
+				}
+			}
+		}
+	}
+	if len(nodes) == 0 {
+		return p.distance(state, "")
+	}
+
+	best := math.Inf(1)
+	for node := range nodes {
+		if d := p.distance(state, node); d < best {
+			best = d
+		}
+	}
+	return best
+}
+
+func (p TargetPredicate) distance(state map[string]*TLAValue, node string) float64 {
+	total := 0.0
+	for _, c := range p.Conditions {
+		left, lok := c.Left.eval(state, node)
+		right, rok := c.Right.eval(state, node)
+		if !lok || !rok {
+			total += 1
+			continue
+		}
+		total += conditionDistance(left, c.Op, right)
+	}
+	return total
+}
+
+func (o Operand) eval(state map[string]*TLAValue, node string) (string, bool) {
+	if o.Variable == "" {
+		return o.Literal, true
+	}
+	value, ok := state[o.Variable]
+	if !ok {
+		return "", false
+	}
+	if o.Key != "" {
+		key := o.Key
+		if key == "*" {
+			key = node
+		}
+		value, ok = value.Get(key)
+		if !ok {
+			return "", false
+		}
+	}
+	if o.Length {
+		if value.Kind != TLASeq && value.Kind != TLASet {
+			return "", false
+		}
+		return strconv.Itoa(value.Len()), true
+	}
+	return value.Text(), true
+}
+
+func conditionDistance(left, op, right string) float64 {
+	l, lerr := strconv.Atoi(left)
+	r, rerr := strconv.Atoi(right)
+	if lerr != nil || rerr != nil {
+		holds := left == right
+		if op == "!=" {
+			holds = !holds
+		}
+		if holds {
+			return 0
+		}
+		return 1
+	}
+
+	var d int
+	switch op {
+	case "=":
+		d = l - r
+		if d < 0 {
+			d = -d
+		}
+	case "!=":
+		if l == r {
+			d = 1
+		}
+	case "<":
+		d = l - r + 1
+	case "<=":
+		d = l - r
+	case ">":
+		d = r - l + 1
+	case ">=":
+		d = r - l
+	default:
+		return 1
+	}
+	if d < 0 {
+		d = 0
+	}
+	return float64(d)
+}
+
+// Proximity of a covered line to a code target
+const (
+	NoProximity     = 0
+	ClassProximity  = 1
+	MethodProximity = 2
+	LineProximity   = 3
+)
+
+// CodeTarget is a location in the Java sources the fuzzer is directed
+// towards. Class is the fully qualified class name, in dotted or JaCoCo
+// notation. Without a Line the target is hit by any line of the Method, and
+// without a Method by any line of the Class.
+type CodeTarget struct {
+	Name   string
+	Class  string
+	Method string
+	Line   int
+}
+
+// proximity returns how close a covered line is to the target, given the
+// method that contains the target
+func (c CodeTarget) proximity(l CoveredLine, method string) int {
+	class := strings.ReplaceAll(c.Class, ".", "/")
+	if l.Class != class && !strings.HasPrefix(l.Class, class+"$") {
+		return NoProximity
+	}
+	sameMethod := method != "" && l.Method == method
+	switch {
+	case c.Line > 0 && l.Class == class && l.Line == c.Line:
+		return LineProximity
+	case c.Line == 0 && c.Method != "" && sameMethod:
+		return LineProximity
+	case c.Line == 0 && c.Method == "":
+		return LineProximity
+	case sameMethod:
+		return MethodProximity
+	default:
+		return ClassProximity
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"path"
+	"path/filepath"
 	"strconv"
 	"time"
 )
@@ -56,9 +58,12 @@ func (mt mutationType) String() string {
 type FuzzerConfig struct {
 	// TimeBudget			int
 	maxMutations int
-	Horizon      int
-	Iterations   int
-	NumNodes     int
+	// Horizon of generated traces, mutated traces vary between MinHorizon and MaxHorizon
+	Horizon    int
+	MinHorizon int
+	MaxHorizon int
+	Iterations int
+	NumNodes   int
 	// RecordPath			string
 	LogLevel       string
 	NetworkPort    int
@@ -74,6 +79,37 @@ type FuzzerConfig struct {
 	MaxMessages       int
 	ReseedFrequency   int
 	RandomSeed        int
+	// Probability of applying each mutator by name, DefaultMutatorWeights if nil
+	MutatorWeights map[string]float64
+	// How mutators are selected, mutators with a zero weight are never selected
+	MutatorSchedule MutatorSchedule
+	// Generator used for seeding and reseeding
+	Generator  GeneratorType
+	PCTDepth   int
+	LeaderBias float64
+	// Samples the parameters of every generated schedule when set
+	Swarm *SwarmConfig
+	// Directory with TLC simulation or counterexample traces for model guided generation
+	ModelTracesDir string
+	// Predicates over TLC states that the fuzzer is directed towards
+	TargetPredicates []TargetPredicate
+	// Locations in the Java sources that the fuzzer is directed towards
+	CodeTargets []CodeTarget
+	// Abstractions of TLC states to additionally track coverage for
+	StateAbstractions []StateAbstraction
+	// Counts states and transitions modulo node renaming when set. Nodes
+	// default to 1..NumNodes.
+	Symmetry *Symmetry
+	// Name of the strategy used to score traces, the mutation type if empty.
+	// The bandit strategy switches between BanditStrategies during the run.
+	Strategy         string
+	BanditStrategies []string
+	BanditWindow     int
+	// Additional strategies as formulas over coverage signals keyed by name,
+	// for example "2*transitions + lines"
+	CustomStrategies map[string]string
+	// Stops the campaign before Iterations once state discovery plateaus when set
+	Plateau *PlateauConfig
 
 	ClusterConfig *ClusterConfig
 	TLCPort       int
@@ -90,6 +126,12 @@ type Fuzzer struct {
 	random        *rand.Rand
 	guider        Guider
 	mutator       Mutator
+	generator     Generator
+	strategy      *Strategy
+	bandit        *StrategyBandit
+	cancel        context.CancelFunc
+	// Executed schedules with the code they covered, minimized into corpus.json
+	coverageCorpus []*CorpusEntry
 }
 
 func NewFuzzer(config FuzzerConfig, fuzzerType FuzzerType, mutationType mutationType) (*Fuzzer, error) {
@@ -100,37 +142,260 @@ func NewFuzzer(config FuzzerConfig, fuzzerType FuzzerType, mutationType mutation
 		mutationType:  mutationType,
 		scheduleQueue: make([]*Trace, 0),
 		stats: &Stats{
-			Coverages:     make([]int, 0),
-			Transitions:   make([]int, 0),
-			CodeCoverage:  make([]int, 0),
-			RandomTraces:  0,
-			MutatedTraces: 0,
+			Coverages:          make([]int, 0),
+			Transitions:        make([]int, 0),
+			CodeCoverage:       make([]int, 0),
+			BranchCoverage:     make([]int, 0),
+			RandomTraces:       0,
+			MutatedTraces:      0,
+			MutatorStats:       make(map[string]*MutatorStat),
+			SwarmStats:         make(map[string]*SwarmStat),
+			TargetDistances:    make(map[string][]float64),
+			TargetHits:         make(map[string]int),
+			CodeTargetHits:     make(map[string]*TargetHit),
+			ActiveStrategies:   make([]string, 0),
+			AbstractCoverages:  make(map[string][]int),
+			VariableValues:     make(map[string][]int),
+			VariableMaxima:     make(map[string][]int),
+			ActionCounts:       make(map[string][]int),
+			ActionPairs:        make([]int, 0),
+			EstimatedCoverages: make([]float64, 0),
+			ScheduleProbes:     make([]int, 0),
+			LineAttribution:    make(map[string]int),
 		},
 		random: rand.New(rand.NewSource(int64(config.RandomSeed))),
 	}
 	f.logger.SetLevel(config.LogLevel)
+	if config.Symmetry != nil && len(config.Symmetry.Nodes) == 0 {
+		for i := 1; i <= config.NumNodes; i++ {
+			config.Symmetry.Nodes = append(config.Symmetry.Nodes, strconv.Itoa(i))
+		}
+	}
+
+	strategies, err := NewStrategyRegistry(config.CustomStrategies)
+	if err != nil {
+		return nil, err
+	}
+	strategyName := config.Strategy
+	if strategyName == "" {
+		strategyName = mutationType.String()
+	}
+	if strategyName == BanditStrategy {
+		armNames := config.BanditStrategies
+		if len(armNames) == 0 {
+			armNames = []string{StateCoverage.String(), TransitionCoverage.String(), CodeAndStateCoverage.String()}
+		}
+		arms := make([]*Strategy, len(armNames))
+		for i, name := range armNames {
+			arm, ok := strategies[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown strategy %s", name)
+			}
+			arms[i] = arm
+		}
+		window := config.BanditWindow
+		if window <= 0 {
+			window = 20
+		}
+		f.bandit = NewStrategyBandit(arms, window)
+	} else {
+		strategy, ok := strategies[strategyName]
+		if !ok {
+			return nil, fmt.Errorf("unknown strategy %s", strategyName)
+		}
+		f.strategy = strategy
+	}
+	if f.config.MinHorizon <= 0 {
+		f.config.MinHorizon = f.config.Horizon / 2
+	}
+	if f.config.MaxHorizon <= 0 {
+		f.config.MaxHorizon = f.config.Horizon * 2
+	}
 
 	// if _, err := os.Stat(config.BaseWorkingDir); err == nil {
 	// 	os.RemoveAll(config.BaseWorkingDir)
 	// }
 	// os.MkdirAll(config.BaseWorkingDir, 0777)
 
-	ctx, _ := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	f.cancel = cancel
 	f.network = NewNetwork(ctx, config.NetworkPort, config.ClusterConfig.ServerType, f.logger.With(LogParams{"type": "network"}))
 	addr := fmt.Sprintf("localhost:%d", config.TLCPort)
-	f.guider = NewGuider(fuzzerType, addr, config.BaseWorkingDir, config.jacocoFile, config.jacocoOutput)
-	f.mutator = CombineMutators(NewSwapCrashNodeMutator(1, f.random), NewSwapNodeMutator(20, f.random), NewSwapMaxMessagesMutator(20, f.random))
+	// Code coverage is only reported for instrumented clusters
+	if config.ClusterConfig.Jacoco == nil {
+		f.config.jacocoOutput = ""
+	}
+	f.guider = NewGuider(fuzzerType, GuiderConfig{
+		TLCAddr:      addr,
+		RecordPath:   config.BaseWorkingDir,
+		JacocoFile:   config.jacocoFile,
+		JacocoOutput: f.config.jacocoOutput,
+		CodeCoverage: config.ClusterConfig.CodeCoverage(),
+		Targets:      config.TargetPredicates,
+		CodeTargets:  config.CodeTargets,
+		Abstractions: config.StateAbstractions,
+		Symmetry:     config.Symmetry,
+	})
+	var visited func(string) bool
+	if f.guider != nil {
+		visited = f.guider.Visited
+	}
+	f.generator = NewGenerator(f.config, visited, f.random)
+	if config.MutatorSchedule == WeightedSchedule {
+		f.mutator = NewWeightedMutator(f.random, f.mutators()...)
+	} else {
+		f.mutator = NewAdaptiveMutator(config.MutatorSchedule, f.stats.MutatorStats, f.random, f.mutators()...)
+	}
 	f.logger.Debug("Initialized fuzzer")
 
 	return f, nil
 }
 
+// DefaultMutatorWeights are the probabilities with which each mutator is
+// applied when generating a mutant. Crossover mutators come first so that the
+// swap mutators are applied on top of the spliced trace.
+func DefaultMutatorWeights() map[string]float64 {
+	return map[string]float64{
+		"splice":          0.2,
+		"crashSplice":     0.2,
+		"leaderCrash":     0.3,
+		"voteStarvation":  0.3,
+		"swapCrashNode":   1,
+		"swapNode":        1,
+		"swapMaxMessages": 1,
+		"extend":          0.1,
+		"truncate":        0.1,
+	}
+}
+
+// mutators returns the available mutators weighted according to the config.
+func (f *Fuzzer) mutators() []WeightedMutator {
+	corpus := func() []*Trace { return f.scheduleQueue }
+	mutators := []WeightedMutator{
+		{Name: "splice", Mutator: NewSpliceMutator(corpus, f.random)},
+		{Name: "crashSplice", Mutator: NewCrashSpliceMutator(corpus, f.random)},
+		{Name: "leaderCrash", Mutator: NewLeaderCrashMutator(f.random)},
+		{Name: "voteStarvation", Mutator: NewVoteStarvationMutator(5, f.random)},
+		{Name: "swapCrashNode", Mutator: NewSwapCrashNodeMutator(1, f.random)},
+		{Name: "swapNode", Mutator: NewSwapNodeMutator(20, f.random)},
+		{Name: "swapMaxMessages", Mutator: NewSwapMaxMessagesMutator(20, f.random)},
+		{Name: "extend", Mutator: NewExtendMutator(f.config.Horizon/4, f.config.MaxHorizon, f.config.NumNodes, f.config.MaxMessages, f.random)},
+		{Name: "truncate", Mutator: NewTruncateMutator(f.config.Horizon/4, f.config.MinHorizon, f.random)},
+	}
+
+	weights := f.config.MutatorWeights
+	if weights == nil {
+		weights = DefaultMutatorWeights()
+	}
+	for i := range mutators {
+		mutators[i].Weight = weights[mutators[i].Name]
+	}
+	return mutators
+}
+
+// signals returns the coverage signals of a check result that strategies are computed over
+func (f *Fuzzer) signals(result CheckResult) map[string]float64 {
+	// The trace fuzzer is guided by new event traces instead of new states
+	novelty := result.NewStates
+	if f.fuzzerType == TraceFuzzer {
+		novelty = result.NewTraces
+	}
+	return map[string]float64{
+		"states":      float64(result.NewStates),
+		"transitions": float64(result.NewTransitions),
+		"lines":       float64(result.NewLines),
+		"branches":    float64(result.NewBranches),
+		"traces":      float64(result.NewTraces),
+		"novelty":     float64(novelty),
+		"oracles":     float64(result.OracleHits),
+	}
+}
+
+func (f *Fuzzer) mutatorStat(name string) *MutatorStat {
+	stat, ok := f.stats.MutatorStats[name]
+	if !ok {
+		stat = &MutatorStat{}
+		f.stats.MutatorStats[name] = stat
+	}
+	return stat
+}
+
+// updateCodeStats records the code covered by the schedule of an iteration
+// and attributes newly covered lines to it
+func (f *Fuzzer) updateCodeStats(iter int, schedule *Trace, result CheckResult) {
+	f.stats.ScheduleProbes = append(f.stats.ScheduleProbes, len(result.Probes))
+	for _, l := range result.Lines {
+		f.stats.LineAttribution[fmt.Sprintf("%s:%d", l.File, l.Line)] = iter
+	}
+	if len(result.Probes) > 0 {
+		f.coverageCorpus = append(f.coverageCorpus, &CorpusEntry{
+			Iteration: iter,
+			Trace:     schedule,
+			Probes:    result.Probes,
+			NumProbes: len(result.Probes),
+		})
+	}
+}
+
+// saveCorpus writes the schedules that together cover all code covered during the run
+func (f *Fuzzer) saveCorpus() error {
+	if len(f.coverageCorpus) == 0 {
+		return nil
+	}
+	dataB, err := json.MarshalIndent(MinimizeCorpus(f.coverageCorpus), "", "\t")
+	if err != nil {
+		return fmt.Errorf("error marshalling corpus: %s", err)
+	}
+	return os.WriteFile(path.Join(f.config.BaseWorkingDir, "corpus.json"), dataB, 0644)
+}
+
+// updateModelStats records the model coverage metrics after an iteration.
+// Variables and actions seen for the first time get zeros for the earlier iterations.
+func (f *Fuzzer) updateModelStats(coverage *ModelCoverage) {
+	iterations := len(f.stats.Coverages)
+	appendHistory(f.stats.VariableValues, coverage.VariableValues(), iterations)
+	appendHistory(f.stats.VariableMaxima, coverage.VariableMaxima(), iterations)
+	appendHistory(f.stats.ActionCounts, coverage.ActionCounts(), iterations)
+	f.stats.ActionPairs = append(f.stats.ActionPairs, coverage.ActionPairs())
+}
+
+// appendHistory appends the values of an iteration to their histories, padding
+// new histories with zeros so that all have one entry per iteration
+func appendHistory(histories map[string][]int, values map[string]int, iterations int) {
+	for name, value := range values {
+		history, ok := histories[name]
+		if !ok {
+			history = make([]int, iterations-1)
+		}
+		histories[name] = append(history, value)
+	}
+}
+
+// updateTargetStats records the closest distance to each target so far and
+// the first iteration at which each target was reached
+func (f *Fuzzer) updateTargetStats(iter int, distances map[string]float64) {
+	for _, target := range f.config.TargetPredicates {
+		best := -1.0
+		if history := f.stats.TargetDistances[target.Name]; len(history) > 0 {
+			best = history[len(history)-1]
+		}
+		if d, ok := distances[target.Name]; ok && (best < 0 || d < best) {
+			best = d
+		}
+		f.stats.TargetDistances[target.Name] = append(f.stats.TargetDistances[target.Name], best)
+		if _, hit := f.stats.TargetHits[target.Name]; !hit && best == 0 {
+			f.stats.TargetHits[target.Name] = iter
+		}
+	}
+}
+
 func (f *Fuzzer) Reset() {
 	f.guider.Reset()
 }
 
 func (f *Fuzzer) Run() {
 	f.logger.Debug("Running fuzzer...")
+	start := time.Now()
 	// iter := 0
 	for iter := 0; iter < f.config.Iterations; iter++ {
 		if iter%10 == 0 {
@@ -140,7 +405,7 @@ func (f *Fuzzer) Run() {
 		if iter%f.config.ReseedFrequency == 0 && f.fuzzerType != RandomFuzzer {
 			f.scheduleQueue = make([]*Trace, 0)
 			for i := 0; i < f.config.SeedPopulation; i++ {
-				f.scheduleQueue = append(f.scheduleQueue, f.GenerateRandom())
+				f.scheduleQueue = append(f.scheduleQueue, f.Generate())
 			}
 		}
 
@@ -159,6 +424,15 @@ func (f *Fuzzer) Run() {
 		f.config.ClusterConfig.RatisDataDir = f.config.RatisDataDir
 		f.config.ClusterConfig.ClusterID = iter
 		f.config.ClusterConfig.SchedulerPort = f.config.NetworkPort
+		if f.config.jacocoOutput != "" && f.guider != nil {
+			// Every schedule records its code coverage in its own exec file
+			execFile, err := filepath.Abs(path.Join(workDir, "jacoco.exec"))
+			if err != nil {
+				f.logger.Error(err.Error())
+			}
+			f.config.ClusterConfig.JacocoExecFile = execFile
+			f.guider.SetExecFile(execFile)
+		}
 		cluster := NewCluster(f.config.ClusterConfig, f.logger.With(LogParams{"type": "cluster"}))
 		cluster.Start()
 
@@ -166,25 +440,29 @@ func (f *Fuzzer) Run() {
 		var schedule *Trace
 		mutated := true
 		if f.fuzzerType == RandomFuzzer {
-			schedule = f.GenerateRandom()
+			schedule = f.Generate()
 			mutated = false
 		} else {
 			if len(f.scheduleQueue) > 0 {
 				schedule = f.scheduleQueue[0]
 				f.scheduleQueue = f.scheduleQueue[1:]
 			} else {
-				schedule = f.GenerateRandom()
+				schedule = f.Generate()
 				mutated = false
 			}
 		}
 
+		horizon := schedule.Steps()
 		crashPoints := make(map[int]string)
-		scheduleFromNode := make([]string, f.config.Horizon)
-		scheduleToNode := make([]string, f.config.Horizon)
-		scheduleMaxMessages := make([]int, f.config.Horizon)
+		scheduleFromNode := make([]string, horizon)
+		scheduleToNode := make([]string, horizon)
+		scheduleMaxMessages := make([]int, horizon)
 		clientRequests := make(map[int]string)
 
 		for _, ch := range schedule.Choices {
+			if ch.Step >= horizon {
+				continue
+			}
 			switch ch.Type {
 			case "Node":
 				scheduleFromNode[ch.Step] = ch.From
@@ -206,9 +484,10 @@ func (f *Fuzzer) Run() {
 		f.logger.Debug("Fuzzer setup complete.")
 		time.Sleep(3 * time.Second)
 
-		for step := 0; step < f.config.Horizon; step++ {
+		for step := 0; step < horizon; step++ {
 
 			f.logger.Debug(strconv.Itoa(step))
+			f.network.SetStep(step)
 			crashNode, ok := crashPoints[step]
 			if ok {
 				n, _ := strconv.Atoi(crashNode)
@@ -252,6 +531,12 @@ func (f *Fuzzer) Run() {
 		// Stop and reset cluster
 		logs := cluster.GetLogs()
 		cluster.Destroy()
+		// The agents only write the exec file when the nodes exit on SIGTERM
+		if execFile := f.config.ClusterConfig.execFile(); execFile != "" {
+			if _, err := os.Stat(execFile); err != nil {
+				f.logger.Error("No JaCoCo execution data written by the nodes: " + err.Error())
+			}
+		}
 
 		// Save logs
 		filePath := workDir + "/logs.log"
@@ -271,34 +556,98 @@ func (f *Fuzzer) Run() {
 		f.network.Reset()
 
 		// Get coverage
-		var newStates bool
-		var weight int
-		var numNewTransitions int
-		var numNewLines int
+		var result CheckResult
 		// for _, event := range eventTrace.Events {
 		// 	f.logger.Info(event.Name)
 		// }
 		if f.guider != nil {
-			newStates, weight, numNewTransitions, numNewLines = f.guider.Check("states", schedule, eventTrace, true)
+			result = f.guider.Check(iter, schedule, eventTrace, true)
+			for _, err := range result.Errors {
+				f.logger.Error(err.Error())
+			}
+		}
+		f.updateCodeStats(iter, schedule, result)
+
+		for _, name := range schedule.Mutators {
+			stat := f.mutatorStat(name)
+			stat.Executed++
+			stat.NewStates += result.NewStates
+			stat.NewTransitions += result.NewTransitions
+			stat.NewLines += result.NewLines
+			stat.NewBranches += result.NewBranches
+			if result.New() {
+				stat.Successes++
+			}
 		}
 
-		var mutationScore int
-		var shouldMutate bool
+		if f.config.Swarm != nil && schedule.Params != nil {
+			key := schedule.Params.Features()
+			stat, ok := f.stats.SwarmStats[key]
+			if !ok {
+				stat = &SwarmStat{}
+				f.stats.SwarmStats[key] = stat
+			}
+			stat.Schedules++
+			stat.NewStates += result.NewStates
+			stat.NewTransitions += result.NewTransitions
+			stat.NewLines += result.NewLines
+			stat.NewBranches += result.NewBranches
+			if result.New() {
+				stat.Successes++
+			}
+		}
 
-		switch f.mutationType {
-		case StateCoverage:
-			shouldMutate = newStates && f.fuzzerType != RandomFuzzer
-			mutationScore = weight
-		case TransitionCoverage:
-			shouldMutate = numNewTransitions > 0 && f.fuzzerType != RandomFuzzer
-			mutationScore = numNewTransitions
-		case CodeAndStateCoverage:
-			shouldMutate = (numNewLines > 0 || weight > 0) && f.fuzzerType != RandomFuzzer
-			mutationScore = numNewLines + weight
-		default:
-			panic("Unknown mutation type or not implemented")
+		strategy := f.strategy
+		if f.bandit != nil {
+			if schedule.Strategy != "" {
+				reward := 0.0
+				if result.New() {
+					reward = 1.0
+				}
+				f.bandit.Update(schedule.Strategy, reward)
+			}
+			strategy = f.bandit.Select()
+			f.logger.With(LogParams{"strategy": strategy.Name}).Debug("Selected strategy.")
+		}
+		f.stats.ActiveStrategies = append(f.stats.ActiveStrategies, strategy.Name)
+
+		mutationScore := 0
+		shouldMutate := false
+		if score := strategy.Score(f.signals(result)); score > 0 && f.fuzzerType != RandomFuzzer {
+			shouldMutate = true
+			mutationScore = int(math.Ceil(score))
 		}
 
+		// Schedules that come closer to a target are mutated with the maximum
+		// number of mutations and their mutants are executed first
+		prioritize := false
+		if directed, ok := f.guider.(DirectedGuider); ok && len(f.config.TargetPredicates) > 0 {
+			distances, improved := directed.TargetDistances()
+			f.updateTargetStats(iter, distances)
+			if improved && f.fuzzerType != RandomFuzzer {
+				prioritize = true
+				shouldMutate = true
+				mutationScore = f.config.maxMutations
+			}
+		}
+		if directed, ok := f.guider.(DirectedGuider); ok && len(f.config.CodeTargets) > 0 {
+			proximity, closer := directed.CodeTargetProximity()
+			for name, p := range proximity {
+				if _, hit := f.stats.CodeTargetHits[name]; !hit && p == LineProximity {
+					f.stats.CodeTargetHits[name] = &TargetHit{
+						Iteration: iter,
+						Seconds:   time.Since(start).Seconds(),
+					}
+				}
+			}
+			if closer && f.fuzzerType != RandomFuzzer {
+				prioritize = true
+				shouldMutate = true
+				mutationScore = f.config.maxMutations
+			}
+		}
+
+		mutants := 0
 		if shouldMutate {
 			fmt.Println("max mutations per schedule:", f.config.maxMutations)
 			if mutationScore > f.config.maxMutations {
@@ -308,10 +657,25 @@ func (f *Fuzzer) Run() {
 			mutatedTraces := make([]*Trace, 0)
 			for i := 0; i < mutationScore*f.config.MutationsPerTrace; i++ {
 				if newTrace, ok := f.mutator.Mutate(schedule, eventTrace); ok {
-					mutatedTraces = append(mutatedTraces, newTrace.Copy())
+					newTrace = newTrace.Copy()
+					newTrace.Strategy = strategy.Name
+					mutatedTraces = append(mutatedTraces, newTrace)
+					for _, name := range newTrace.Mutators {
+						f.mutatorStat(name).Generated++
+					}
 				}
 			}
-			f.scheduleQueue = append(f.scheduleQueue, mutatedTraces...)
+			if prioritize {
+				f.scheduleQueue = append(mutatedTraces, f.scheduleQueue...)
+			} else {
+				f.scheduleQueue = append(f.scheduleQueue, mutatedTraces...)
+			}
+			mutants = len(mutatedTraces)
+		}
+		// A strategy without mutants is never rewarded through them, so its
+		// pull is recorded here to keep the bandit from selecting it forever
+		if f.bandit != nil && mutants == 0 {
+			f.bandit.Update(strategy.Name, 0)
 		}
 
 		// Update stats
@@ -323,95 +687,89 @@ func (f *Fuzzer) Run() {
 		f.stats.Coverages = append(f.stats.Coverages, f.guider.Coverage())
 		f.stats.Transitions = append(f.stats.Transitions, f.guider.TransitionCoverage())
 		f.stats.CodeCoverage = append(f.stats.CodeCoverage, CoverageDataLength())
+		f.stats.BranchCoverage = append(f.stats.BranchCoverage, BranchDataLength())
+		for name, coverage := range f.guider.AbstractCoverage() {
+			f.stats.AbstractCoverages[name] = append(f.stats.AbstractCoverages[name], coverage)
+		}
+		f.updateModelStats(f.guider.ModelCoverage())
+		estimate := f.guider.EstimatedCoverage()
+		f.stats.EstimatedCoverages = append(f.stats.EstimatedCoverages, estimate)
 
 		// Save stats
 		if iter%5 == 0 {
-			// Save stats
-			filePath := path.Join(f.config.BaseWorkingDir, "stats.json")
-			dataB, err := json.MarshalIndent(f.stats, "", "\t")
-			if err != nil {
+			if err := f.saveStats(); err != nil {
+				f.logger.Error(err.Error())
 				return
 			}
-
-			if _, err := os.Stat(filePath); err == nil {
-				os.Remove(filePath)
-			}
-
-			file, err := os.Create(filePath)
-			if err != nil {
-				return
-			}
-			defer file.Close()
-			writer := bufio.NewWriter(file)
-			writer.Write(dataB)
-			writer.Flush()
-		}
-	}
-
-	// Save stats
-	{
-		filePath := path.Join(f.config.BaseWorkingDir, "stats.json")
-		dataB, err := json.MarshalIndent(f.stats, "", "\t")
-		if err != nil {
-			return
 		}
 
-		if _, err := os.Stat(filePath); err == nil {
-			os.Remove(filePath)
+		if f.config.Plateau != nil && f.config.Plateau.Reached(f.stats.Coverages, estimate) {
+			f.logger.Info(fmt.Sprintf("State discovery plateaued at iteration %d with %d of an estimated %.1f states, stopping", iter, f.guider.Coverage(), estimate))
+			f.stats.StoppedAt = iter
+			break
 		}
+	}
 
-		file, err := os.Create(filePath)
-		if err != nil {
-			return
-		}
-		defer file.Close()
-		writer := bufio.NewWriter(file)
-		writer.Write(dataB)
-		writer.Flush()
+	if err := f.saveStats(); err != nil {
+		f.logger.Error(err.Error())
+	}
+	if err := f.saveCorpus(); err != nil {
+		f.logger.Error(err.Error())
 	}
 }
 
-func (f *Fuzzer) GenerateRandom() *Trace {
-	trace := NewTrace()
-	for i := 0; i < f.config.Horizon; i++ {
-		fromIdx := f.random.Intn(f.config.NumNodes) + 1
-		toIdx := f.random.Intn(f.config.NumNodes) + 1
-		trace.Add(Choice{
-			Type:        "Node",
-			Step:        i,
-			From:        strconv.Itoa(fromIdx),
-			To:          strconv.Itoa(toIdx),
-			MaxMessages: f.random.Intn(f.config.MaxMessages),
-		})
+// saveStats writes the stats, the explored state graph and the code coverage to
+// the working directory. Only failing to write the stats is returned, failed
+// exports of the graph and coverage reports are logged.
+func (f *Fuzzer) saveStats() error {
+	filePath := path.Join(f.config.BaseWorkingDir, "stats.json")
+	dataB, err := json.MarshalIndent(f.stats, "", "\t")
+	if err != nil {
+		return fmt.Errorf("error marshalling stats: %s", err)
 	}
-	choices := make([]int, f.config.Horizon)
-	for i := 0; i < f.config.Horizon; i++ {
-		choices[i] = i
+
+	if _, err := os.Stat(filePath); err == nil {
+		os.Remove(filePath)
 	}
-	for _, c := range sample(choices, f.config.NumCrashes, f.random) {
-		idx := f.random.Intn(f.config.NumNodes) + 1
-		trace.Add(Choice{
-			Type: "Crash",
-			Node: strconv.Itoa(idx),
-			Step: c,
-		})
 
-		// s := sample(intRange(c, f.config.InitialHorizon), 1, f.random)[0]
-		// trace.Add(Choice{
-		// 	Type: "Start",
-		// 	Node: idx,
-		// 	Step: s,
-		// })
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("error creating stats file: %s", err)
+	}
+	defer file.Close()
+	writer := bufio.NewWriter(file)
+	writer.Write(dataB)
+	writer.Flush()
+
+	if f.guider != nil {
+		if err := f.guider.StateGraph().Save(path.Join(f.config.BaseWorkingDir, "state_graph")); err != nil {
+			f.logger.Error(fmt.Sprintf("error saving state graph: %s", err))
+		}
+	}
+	if f.config.jacocoOutput != "" {
+		sourceDirs := f.config.ClusterConfig.CodeCoverage().SourceDirs
+		if err := SaveCoverageReports(path.Join(f.config.BaseWorkingDir, "coverage"), sourceDirs); err != nil {
+			f.logger.Error(fmt.Sprintf("error saving coverage reports: %s", err))
+		}
 	}
+	return nil
+}
 
-	for _, req := range sample(choices, f.config.NumRequests, f.random) {
-		trace.Add(Choice{
-			Type: "ClientRequest",
-			Op:   "write",
-			Step: req,
-		})
+// Generate creates a new seed schedule with the configured generator
+func (f *Fuzzer) Generate() *Trace {
+	params := ScheduleParams{
+		Horizon:     f.config.Horizon,
+		NumNodes:    f.config.NumNodes,
+		NumCrashes:  f.config.NumCrashes,
+		NumRequests: f.config.NumRequests,
+		MaxMessages: f.config.MaxMessages,
+	}
+	if f.config.Swarm != nil {
+		params = f.config.Swarm.Sample(params, f.random)
 	}
-	return trace
+	return f.generator.Generate(params)
 }
 
-func (f *Fuzzer) Cleanup() {}
+func (f *Fuzzer) Cleanup() {
+	f.cancel()
+}
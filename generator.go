@@ -0,0 +1,366 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+)
+
+type GeneratorType int
+
+const (
+	UniformGeneration        GeneratorType = 0
+	PCTGeneration            GeneratorType = 1
+	LeaderBiasedGeneration   GeneratorType = 2
+	RoundRobinGeneration     GeneratorType = 3
+	PartitionHeavyGeneration GeneratorType = 4
+	ModelGuidedGeneration    GeneratorType = 5
+)
+
+func (gt GeneratorType) String() string {
+	switch gt {
+	case UniformGeneration:
+		return "uniform"
+	case PCTGeneration:
+		return "pct"
+	case LeaderBiasedGeneration:
+		return "leaderBiased"
+	case RoundRobinGeneration:
+		return "roundRobin"
+	case PartitionHeavyGeneration:
+		return "partitionHeavy"
+	case ModelGuidedGeneration:
+		return "modelGuided"
+	default:
+		return fmt.Sprintf("%d", int(gt))
+	}
+}
+
+// ScheduleParams configures the shape of a generated schedule
+type ScheduleParams struct {
+	Horizon     int
+	NumNodes    int
+	NumCrashes  int
+	NumRequests int
+	MaxMessages int
+}
+
+// Features returns the combination of choice types enabled by the params
+// together with coarse buckets of the number of crashes, requests and max
+// messages, for example "delivery+crash/crashes=4-7/requests=0/messages=16-31"
+func (p ScheduleParams) Features() string {
+	features := "delivery"
+	if p.NumCrashes > 0 {
+		features += "+crash"
+	}
+	if p.NumRequests > 0 {
+		features += "+request"
+	}
+	return fmt.Sprintf("%s/crashes=%s/requests=%s/messages=%s", features, bucket(p.NumCrashes), bucket(p.NumRequests), bucket(p.MaxMessages))
+}
+
+// bucket returns the power of two range containing n, e.g. "4-7"
+func bucket(n int) string {
+	if n <= 1 {
+		return strconv.Itoa(n)
+	}
+	low := 1
+	for low*2 <= n {
+		low *= 2
+	}
+	return fmt.Sprintf("%d-%d", low, 2*low-1)
+}
+
+// SwarmConfig configures swarm testing, where every generated schedule samples
+// its own parameters. Ranges are inclusive and each optional choice type is
+// enabled for a schedule with probability FeatureProbability.
+type SwarmConfig struct {
+	CrashRange         [2]int
+	RequestRange       [2]int
+	MaxMessagesRange   [2]int
+	FeatureProbability float64
+}
+
+// Sample draws the parameters of a single schedule
+func (s *SwarmConfig) Sample(base ScheduleParams, r *rand.Rand) ScheduleParams {
+	params := base
+	params.NumCrashes = 0
+	params.NumRequests = 0
+	if r.Float64() < s.FeatureProbability {
+		params.NumCrashes = sampleRange(s.CrashRange, r)
+	}
+	if r.Float64() < s.FeatureProbability {
+		params.NumRequests = sampleRange(s.RequestRange, r)
+	}
+	params.MaxMessages = sampleRange(s.MaxMessagesRange, r)
+	if params.MaxMessages < 1 {
+		params.MaxMessages = 1
+	}
+	return params
+}
+
+func sampleRange(bounds [2]int, r *rand.Rand) int {
+	if bounds[1] <= bounds[0] {
+		return bounds[0]
+	}
+	return bounds[0] + r.Intn(bounds[1]-bounds[0]+1)
+}
+
+// Generator creates new seed schedules
+type Generator interface {
+	Generate(ScheduleParams) *Trace
+}
+
+// NewGenerator creates the generator configured in config. Visited reports
+// whether a normalized TLC state representation has been reached before and
+// is used by model guided generation.
+func NewGenerator(config FuzzerConfig, visited func(string) bool, random *rand.Rand) Generator {
+	switch config.Generator {
+	case ModelGuidedGeneration:
+		return NewModelGenerator(config.ModelTracesDir, NewUniformGenerator(random), visited, random)
+	case PCTGeneration:
+		return NewPCTGenerator(config.PCTDepth, random)
+	case LeaderBiasedGeneration:
+		return NewLeaderBiasedGenerator(config.LeaderBias, random)
+	case RoundRobinGeneration:
+		return NewRoundRobinGenerator(random)
+	case PartitionHeavyGeneration:
+		return NewPartitionGenerator(config.Horizon/10, random)
+	default:
+		return NewUniformGenerator(random)
+	}
+}
+
+// addFaults adds crashes and client requests at uniformly sampled steps
+func addFaults(trace *Trace, params ScheduleParams, r *rand.Rand) {
+	choices := intRange(0, params.Horizon)
+	for _, c := range sample(choices, params.NumCrashes, r) {
+		idx := r.Intn(params.NumNodes) + 1
+		trace.Add(Choice{
+			Type: "Crash",
+			Node: strconv.Itoa(idx),
+			Step: c,
+		})
+	}
+
+	for _, req := range sample(choices, params.NumRequests, r) {
+		trace.Add(Choice{
+			Type: "ClientRequest",
+			Op:   "write",
+			Step: req,
+		})
+	}
+}
+
+// nodePairs returns all ordered pairs of distinct nodes
+func nodePairs(numNodes int) [][2]int {
+	pairs := make([][2]int, 0, numNodes*(numNodes-1))
+	for from := 1; from <= numNodes; from++ {
+		for to := 1; to <= numNodes; to++ {
+			if from != to {
+				pairs = append(pairs, [2]int{from, to})
+			}
+		}
+	}
+	return pairs
+}
+
+func deliveryChoice(step, from, to, maxMessages int, r *rand.Rand) Choice {
+	return Choice{
+		Type:        "Node",
+		Step:        step,
+		From:        strconv.Itoa(from),
+		To:          strconv.Itoa(to),
+		MaxMessages: r.Intn(maxMessages),
+	}
+}
+
+// UniformGenerator picks the nodes to deliver between uniformly at random at every step
+type UniformGenerator struct {
+	r *rand.Rand
+}
+
+var _ Generator = &UniformGenerator{}
+
+func NewUniformGenerator(random *rand.Rand) *UniformGenerator {
+	return &UniformGenerator{
+		r: random,
+	}
+}
+
+func (u *UniformGenerator) Generate(params ScheduleParams) *Trace {
+	trace := NewTrace()
+	trace.Horizon = params.Horizon
+	trace.Params = &params
+	for i := 0; i < params.Horizon; i++ {
+		fromIdx := u.r.Intn(params.NumNodes) + 1
+		toIdx := u.r.Intn(params.NumNodes) + 1
+		trace.Add(deliveryChoice(i, fromIdx, toIdx, params.MaxMessages, u.r))
+	}
+	addFaults(trace, params, u.r)
+	return trace
+}
+
+// PCTGenerator assigns random priorities to the node pairs and delivers
+// between the highest priority pair at every step. At Depth-1 randomly chosen
+// change points the current highest priority pair is demoted to the lowest
+// priority, as in probabilistic concurrency testing.
+type PCTGenerator struct {
+	Depth int
+	r     *rand.Rand
+}
+
+var _ Generator = &PCTGenerator{}
+
+func NewPCTGenerator(depth int, random *rand.Rand) *PCTGenerator {
+	if depth < 1 {
+		depth = 1
+	}
+	return &PCTGenerator{
+		Depth: depth,
+		r:     random,
+	}
+}
+
+func (p *PCTGenerator) Generate(params ScheduleParams) *Trace {
+	trace := NewTrace()
+	trace.Horizon = params.Horizon
+	trace.Params = &params
+
+	pairs := nodePairs(params.NumNodes)
+	priorities := make([][2]int, len(pairs))
+	for i, j := range p.r.Perm(len(pairs)) {
+		priorities[i] = pairs[j]
+	}
+	changePoints := make(map[int]bool)
+	for _, c := range sample(intRange(0, params.Horizon), p.Depth-1, p.r) {
+		changePoints[c] = true
+	}
+
+	for i := 0; i < params.Horizon; i++ {
+		if changePoints[i] && len(priorities) > 1 {
+			priorities = append(priorities[1:], priorities[0])
+		}
+		if len(priorities) == 0 {
+			continue
+		}
+		pair := priorities[0]
+		trace.Add(deliveryChoice(i, pair[0], pair[1], params.MaxMessages, p.r))
+	}
+	addFaults(trace, params, p.r)
+	return trace
+}
+
+// LeaderBiasedGenerator picks a presumed leader per schedule and delivers its
+// messages to the other nodes with probability Bias, falling back to a
+// uniform choice otherwise.
+type LeaderBiasedGenerator struct {
+	Bias float64
+	r    *rand.Rand
+}
+
+var _ Generator = &LeaderBiasedGenerator{}
+
+func NewLeaderBiasedGenerator(bias float64, random *rand.Rand) *LeaderBiasedGenerator {
+	return &LeaderBiasedGenerator{
+		Bias: bias,
+		r:    random,
+	}
+}
+
+func (l *LeaderBiasedGenerator) Generate(params ScheduleParams) *Trace {
+	trace := NewTrace()
+	trace.Horizon = params.Horizon
+	trace.Params = &params
+
+	leader := l.r.Intn(params.NumNodes) + 1
+	for i := 0; i < params.Horizon; i++ {
+		fromIdx := l.r.Intn(params.NumNodes) + 1
+		toIdx := l.r.Intn(params.NumNodes) + 1
+		if params.NumNodes > 1 && l.r.Float64() < l.Bias {
+			fromIdx = leader
+			for toIdx == leader {
+				toIdx = l.r.Intn(params.NumNodes) + 1
+			}
+		}
+		trace.Add(deliveryChoice(i, fromIdx, toIdx, params.MaxMessages, l.r))
+	}
+	addFaults(trace, params, l.r)
+	return trace
+}
+
+// RoundRobinGenerator cycles through all pairs of distinct nodes in a random order
+type RoundRobinGenerator struct {
+	r *rand.Rand
+}
+
+var _ Generator = &RoundRobinGenerator{}
+
+func NewRoundRobinGenerator(random *rand.Rand) *RoundRobinGenerator {
+	return &RoundRobinGenerator{
+		r: random,
+	}
+}
+
+func (rr *RoundRobinGenerator) Generate(params ScheduleParams) *Trace {
+	trace := NewTrace()
+	trace.Horizon = params.Horizon
+	trace.Params = &params
+
+	pairs := nodePairs(params.NumNodes)
+	order := rr.r.Perm(len(pairs))
+	for i := 0; i < params.Horizon && len(pairs) > 0; i++ {
+		pair := pairs[order[i%len(order)]]
+		trace.Add(deliveryChoice(i, pair[0], pair[1], params.MaxMessages, rr.r))
+	}
+	addFaults(trace, params, rr.r)
+	return trace
+}
+
+// PartitionGenerator splits the schedule into windows of random length and
+// partitions the nodes in two groups for each window. Messages are only
+// delivered between nodes of the same group.
+type PartitionGenerator struct {
+	MaxWindow int
+	r         *rand.Rand
+}
+
+var _ Generator = &PartitionGenerator{}
+
+func NewPartitionGenerator(maxWindow int, random *rand.Rand) *PartitionGenerator {
+	if maxWindow < 1 {
+		maxWindow = 1
+	}
+	return &PartitionGenerator{
+		MaxWindow: maxWindow,
+		r:         random,
+	}
+}
+
+func (p *PartitionGenerator) Generate(params ScheduleParams) *Trace {
+	trace := NewTrace()
+	trace.Horizon = params.Horizon
+	trace.Params = &params
+
+	side := make([]bool, params.NumNodes+1)
+	windowEnd := 0
+	for i := 0; i < params.Horizon; i++ {
+		if i == windowEnd {
+			windowEnd = i + 1 + p.r.Intn(p.MaxWindow)
+			for n := 1; n <= params.NumNodes; n++ {
+				side[n] = p.r.Intn(2) == 0
+			}
+		}
+		fromIdx := p.r.Intn(params.NumNodes) + 1
+		group := make([]int, 0, params.NumNodes)
+		for n := 1; n <= params.NumNodes; n++ {
+			if side[n] == side[fromIdx] {
+				group = append(group, n)
+			}
+		}
+		toIdx := group[p.r.Intn(len(group))]
+		trace.Add(deliveryChoice(i, fromIdx, toIdx, params.MaxMessages, p.r))
+	}
+	addFaults(trace, params, p.r)
+	return trace
+}
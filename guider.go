@@ -14,18 +14,82 @@ import (
 	"strings"
 )
 
+// CheckResult is the coverage feedback of executing a single trace
+type CheckResult struct {
+	NewStates      int
+	NewTransitions int
+	NewLines       int
+	NewBranches    int
+	NewTraces      int
+	// Number of target predicates and code targets reached by the trace
+	OracleHits int
+	// Code coverage probes hit by the trace, nil if the exec file could not be read
+	Probes []Probe
+	// Lines covered for the first time by the trace
+	Lines  []CoveredLine
+	Errors []error
+}
+
+// New reports whether the trace discovered anything new
+func (r CheckResult) New() bool {
+	return r.NewStates > 0 || r.NewTransitions > 0 || r.NewLines > 0 || r.NewBranches > 0 || r.NewTraces > 0
+}
+
 type Guider interface {
-	Check(iter string, trace *Trace, eventTrace *EventTrace, record bool) (bool, int, int, int)
+	// Check runs the trace through TLC and attributes new coverage to the fuzzer iteration
+	Check(iter int, trace *Trace, eventTrace *EventTrace, record bool) CheckResult
 	Coverage() int
 	TransitionCoverage() int
+	// AbstractCoverage returns the number of abstract states reached for each abstraction
+	AbstractCoverage() map[string]int
+	// ModelCoverage returns the metrics derived from the states and actions exercised
+	ModelCoverage() *ModelCoverage
+	// StateGraph returns the graph of the states and transitions reached
+	StateGraph() *StateGraph
+	// EstimatedCoverage estimates the total number of states including undiscovered ones
+	EstimatedCoverage() float64
+	// Visited reports whether a state with the normalized representation has been reached
+	Visited(repr string) bool
+	// SetExecFile sets the JaCoCo exec file the coverage of the next checked trace is read from
+	SetExecFile(path string)
 	Reset()
 }
 
-func NewGuider(fuzzerType FuzzerType, addr, recordPath string, jacocoFile string, jacocoOutput string) Guider {
+// DirectedGuider is implemented by guiders that measure how close a trace
+// came to the configured targets. TargetDistances returns the distance to
+// each target predicate reached by the last checked trace and whether the
+// trace came closer to any predicate than all traces before it.
+// CodeTargetProximity returns the proximity of the lines covered by the
+// last checked trace to each code target and whether the trace came closer to
+// any code target than all traces before it.
+type DirectedGuider interface {
+	TargetDistances() (map[string]float64, bool)
+	CodeTargetProximity() (map[string]int, bool)
+}
+
+// GuiderConfig configures the coverage guiders
+type GuiderConfig struct {
+	TLCAddr      string
+	RecordPath   string
+	JacocoFile   string
+	JacocoOutput string
+	// Classes and sources of the server type the JaCoCo report is generated for
+	CodeCoverage *CodeCoverageConfig
+	// Predicates over TLC states the fuzzer is directed towards
+	Targets []TargetPredicate
+	// Locations in the Java sources the fuzzer is directed towards
+	CodeTargets []CodeTarget
+	// Abstractions of TLC states to track coverage for in addition to TLC fingerprints
+	Abstractions []StateAbstraction
+	// Counts states and transitions modulo node renaming when set
+	Symmetry *Symmetry
+}
+
+func NewGuider(fuzzerType FuzzerType, config GuiderConfig) Guider {
 	if fuzzerType == ModelFuzz || fuzzerType == RandomFuzzer {
-		return NewTLCStateGuider(addr, recordPath, jacocoFile, jacocoOutput)
+		return NewTLCStateGuider(config)
 	} else if fuzzerType == TraceFuzzer {
-		return NewTraceCoverageGuider(addr, recordPath, jacocoFile, jacocoOutput)
+		return NewTraceCoverageGuider(config)
 	} else {
 		return nil
 	}
@@ -34,62 +98,264 @@ func NewGuider(fuzzerType FuzzerType, addr, recordPath string, jacocoFile string
 type TLCStateGuider struct {
 	TLCAddr          string
 	statesMap        map[int64]bool
+	stateFrequencies map[int64]int
+	stateReprs       map[string]bool
 	tlcClient        *TLCClient
 	stateTransitions map[int64][]int64
 	recordPath       string
 	jacocoFile       string
 	jacocoOutput     string
+	codeCoverage     *CodeCoverageConfig
+	// Probes hit so far by class id, read from the exec file
+	probes map[uint64][]bool
+	// Lines and branches covered by each probe, from analyzing the classes once
+	probeTable *ProbeTable
+
+	targets       []TargetPredicate
+	bestDistances map[string]float64
+	lastDistances map[string]float64
+	improved      bool
+
+	codeTargets   []CodeTarget
+	bestProximity map[string]int
+	codeProximity map[string]int
+	closer        bool
+
+	abstractions   []StateAbstraction
+	abstractStates map[string]map[uint64]bool
+	symmetry       *Symmetry
+
+	modelCoverage *ModelCoverage
+	stateGraph    *StateGraph
 }
 
 var _ Guider = &TLCStateGuider{}
+var _ DirectedGuider = &TLCStateGuider{}
 
-func NewTLCStateGuider(tlcAddr, recordPath string, jacocoFile string, jacocoOutput string) *TLCStateGuider {
+func NewTLCStateGuider(config GuiderConfig) *TLCStateGuider {
+	abstractStates := make(map[string]map[uint64]bool)
+	for _, a := range config.Abstractions {
+		abstractStates[a.Name] = make(map[uint64]bool)
+	}
+	if config.CodeCoverage == nil {
+		config.CodeCoverage = DefaultCodeCoverageConfig(Xraft)
+	}
+	var probeTable *ProbeTable
+	if config.JacocoOutput != "" {
+		probeTable = AnalyzeClasses(config.CodeCoverage.ClassDirs)
+		registerLines(probeTable)
+	}
 	return &TLCStateGuider{
-		TLCAddr:          tlcAddr,
+		TLCAddr:          config.TLCAddr,
 		statesMap:        make(map[int64]bool),
-		tlcClient:        NewTLCClient(tlcAddr),
+		stateFrequencies: make(map[int64]int),
+		stateReprs:       make(map[string]bool),
+		tlcClient:        NewTLCClient(config.TLCAddr),
 		stateTransitions: make(map[int64][]int64),
-		recordPath:       recordPath,
-		jacocoFile:       jacocoFile,
-		jacocoOutput:     jacocoOutput,
+		recordPath:       config.RecordPath,
+		jacocoFile:       config.JacocoFile,
+		jacocoOutput:     config.JacocoOutput,
+		codeCoverage:     config.CodeCoverage,
+		probes:           make(map[uint64][]bool),
+		probeTable:       probeTable,
+		targets:          config.Targets,
+		bestDistances:    make(map[string]float64),
+		lastDistances:    make(map[string]float64),
+		codeTargets:      config.CodeTargets,
+		bestProximity:    make(map[string]int),
+		codeProximity:    make(map[string]int),
+		abstractions:     config.Abstractions,
+		abstractStates:   abstractStates,
+		symmetry:         config.Symmetry,
+		modelCoverage:    NewModelCoverage(),
+		stateGraph:       NewStateGraph(),
 	}
 }
 
 func (t *TLCStateGuider) Reset() {
 	t.statesMap = make(map[int64]bool)
+	t.stateFrequencies = make(map[int64]int)
+	t.stateReprs = make(map[string]bool)
+	for name := range t.abstractStates {
+		t.abstractStates[name] = make(map[uint64]bool)
+	}
+	t.modelCoverage = NewModelCoverage()
 	// clearCovData(t.objectPath)
 }
 
+func (t *TLCStateGuider) SetExecFile(path string) {
+	t.jacocoFile = path
+}
+
 func (t *TLCStateGuider) Coverage() int {
 	return len(t.statesMap)
 }
 
+func (t *TLCStateGuider) EstimatedCoverage() float64 {
+	return Chao1(t.stateFrequencies)
+}
+
 func (t *TLCStateGuider) TransitionCoverage() int {
 	return len(t.stateTransitions)
 }
 
-func (t *TLCStateGuider) Check(iter string, trace *Trace, eventTrace *EventTrace, record bool) (bool, int, int, int) {
+func (t *TLCStateGuider) AbstractCoverage() map[string]int {
+	coverage := make(map[string]int)
+	for name, states := range t.abstractStates {
+		coverage[name] = len(states)
+	}
+	return coverage
+}
 
-	numNewStates := 0
-	numNewTransitions := 0
-	numNewLines := 0
-	if tlcStates, err := t.tlcClient.SendTrace(eventTrace); err == nil {
+func (t *TLCStateGuider) ModelCoverage() *ModelCoverage {
+	return t.modelCoverage
+}
+
+func (t *TLCStateGuider) StateGraph() *StateGraph {
+	return t.stateGraph
+}
+
+// stateEvents returns the name of the event that led to each state. TLC
+// returns the initial state followed by the state after each event; if the
+// number of states does not match the events the names are left empty.
+func stateEvents(states []TLCState, events []Event) []string {
+	names := make([]string, len(states))
+	actions := make([]string, 0, len(events))
+	for _, e := range events {
+		if !e.Reset {
+			actions = append(actions, e.Name)
+		}
+	}
+	if len(states) == len(actions)+1 {
+		copy(names[1:], actions)
+	}
+	return names
+}
+
+func (t *TLCStateGuider) TargetDistances() (map[string]float64, bool) {
+	return t.lastDistances, t.improved
+}
+
+// updateDistances computes the distance of the closest state to each target
+func (t *TLCStateGuider) updateDistances(tlcStates []TLCState) {
+	for _, s := range tlcStates {
+		for _, target := range t.targets {
+			d := target.Distance(s.State)
+			if last, ok := t.lastDistances[target.Name]; !ok || d < last {
+				t.lastDistances[target.Name] = d
+			}
+		}
+	}
+	for name, d := range t.lastDistances {
+		if best, ok := t.bestDistances[name]; !ok || d < best {
+			t.bestDistances[name] = d
+			t.improved = true
+		}
+	}
+}
+
+func (t *TLCStateGuider) CodeTargetProximity() (map[string]int, bool) {
+	return t.codeProximity, t.closer
+}
+
+// updateCodeProximity computes the proximity of the lines covered by the
+// iteration to each code target. Only the first iteration hitting a target
+// reports the line proximity. MethodAt locates the method of a target line.
+func (t *TLCStateGuider) updateCodeProximity(methodAt func(string, int) string, lines []CoveredLine) {
+	for _, target := range t.codeTargets {
+		targetMethod := target.Method
+		if targetMethod == "" && target.Line > 0 {
+			targetMethod = methodAt(target.Class, target.Line)
+		}
+		best := NoProximity
+		for _, l := range lines {
+			if p := target.proximity(l, targetMethod); p > best {
+				best = p
+			}
+		}
+		if best > t.bestProximity[target.Name] {
+			t.bestProximity[target.Name] = best
+			t.closer = true
+		} else if best == LineProximity {
+			best = NoProximity
+		}
+		t.codeProximity[target.Name] = best
+	}
+}
+
+// canonicalStates replaces the keys of the states with the keys of their
+// canonical representatives under node renaming
+func (t *TLCStateGuider) canonicalStates(tlcStates []TLCState) []TLCState {
+	canonical := make([]TLCState, len(tlcStates))
+	for i, s := range tlcStates {
+		canonical[i] = TLCState{
+			Repr:       s.Repr,
+			Key:        s.Key,
+			State:      s.State,
+			ParseError: s.ParseError,
+		}
+		if s.State != nil {
+			canonical[i].Key = t.symmetry.Key(s.State)
+		}
+	}
+	return canonical
+}
+
+func (t *TLCStateGuider) Visited(repr string) bool {
+	return t.stateReprs[repr]
+}
+
+func (t *TLCStateGuider) Check(iter int, trace *Trace, eventTrace *EventTrace, record bool) CheckResult {
+	result := CheckResult{
+		Errors: make([]error, 0),
+	}
+	t.lastDistances = make(map[string]float64)
+	t.improved = false
+	t.codeProximity = make(map[string]int)
+	t.closer = false
+	tlcStates, err := t.tlcClient.SendTrace(eventTrace)
+	if err != nil {
+		result.Errors = append(result.Errors, err)
+	} else {
 		if record {
-			t.recordTrace(iter, trace, eventTrace, tlcStates)
+			t.recordTrace("states", trace, eventTrace, tlcStates)
 		}
 
 		// Update states and transitions
+		if t.symmetry != nil {
+			tlcStates = t.canonicalStates(tlcStates)
+		}
+		reached := make(map[int64]bool)
 		for _, s := range tlcStates {
 			_, ok := t.statesMap[s.Key]
 			if !ok {
-				numNewStates += 1
+				result.NewStates += 1
 				t.statesMap[s.Key] = true
 			}
+			if !reached[s.Key] {
+				reached[s.Key] = true
+				t.stateFrequencies[s.Key] += 1
+			}
+			t.stateReprs[normalizeRepr(s.Repr)] = true
+
+			if s.ParseError != nil {
+				result.Errors = append(result.Errors, fmt.Errorf("failed to parse TLC state %d: %v", s.Key, s.ParseError))
+				continue
+			}
+			for _, a := range t.abstractions {
+				t.abstractStates[a.Name][a.Key(s.State)] = true
+			}
+		}
+		t.modelCoverage.Update(tlcStates, eventTrace.Events)
+		if len(t.targets) > 0 {
+			t.updateDistances(tlcStates)
 		}
 
 		start := true
 		previous_state := int64(-1)
-		for _, s := range tlcStates {
+		events := stateEvents(tlcStates, eventTrace.Events)
+		for i, s := range tlcStates {
+			t.stateGraph.AddState(s)
 			if start {
 				previous_state = s.Key
 				start = false
@@ -105,24 +371,59 @@ func (t *TLCStateGuider) Check(iter string, trace *Trace, eventTrace *EventTrace
 				}
 				if !exists {
 					t.stateTransitions[prevKey] = append(t.stateTransitions[prevKey], currKey)
-					numNewTransitions += 1
+					result.NewTransitions += 1
 				}
+				t.stateGraph.AddTransition(prevKey, currKey, events[i], iter)
 				previous_state = currKey
 			}
 		}
 
 		if t.jacocoOutput != "" {
-			if err := t.generateXMLReport(); err != nil {
-				fmt.Printf("failed to generate XML report: %v", err)
-			}
-			numNewLines, err = parseCoverageAndUpdate(t.jacocoOutput)
+			data, probes, found, err := t.readProbes()
 			if err != nil {
-				fmt.Printf("failed to parse coverage: %v", err)
+				result.Errors = append(result.Errors, fmt.Errorf("failed to read exec file: %v", err))
+			}
+			result.Probes = probes
+			if lines, branches, ok := t.probeTable.Map(data); ok {
+				newLines, newBranches := updateCoverage(lines, branches, iter)
+				if len(t.codeTargets) > 0 {
+					t.updateCodeProximity(t.probeTable.methodAt, lines)
+				}
+				result.NewLines = len(newLines)
+				result.NewBranches = newBranches
+				result.Lines = newLines
+			} else if found || len(t.codeTargets) > 0 {
+				// Fall back to the JaCoCo report if the probes could not be
+				// mapped. Proximity to the code targets depends on all lines
+				// the iteration covered, so the report is needed even without
+				// new probes.
+				if err := t.generateXMLReport(); err != nil {
+					result.Errors = append(result.Errors, fmt.Errorf("failed to generate XML report: %v", err))
+				}
+				newLines, report, err := parseCoverageAndUpdate(t.jacocoOutput, iter)
+				if err != nil {
+					result.Errors = append(result.Errors, fmt.Errorf("failed to parse coverage: %v", err))
+				} else if len(t.codeTargets) > 0 {
+					t.updateCodeProximity(report.methodAt, report.coveredLines())
+				}
+				result.NewLines = len(newLines)
+				result.Lines = newLines
+			}
+		}
+
+		for _, d := range t.lastDistances {
+			if d == 0 {
+				result.OracleHits += 1
+			}
+		}
+		for _, p := range t.codeProximity {
+			if p == LineProximity {
+				result.OracleHits += 1
 			}
 		}
 	}
 
-	return numNewStates != 0, numNewStates, numNewTransitions, numNewLines
+	return result
 }
 
 func (t *TLCStateGuider) recordTrace(as string, trace *Trace, eventTrace *EventTrace, states []TLCState) {
@@ -131,7 +432,7 @@ func (t *TLCStateGuider) recordTrace(as string, trace *Trace, eventTrace *EventT
 	data := map[string]interface{}{
 		"trace":       trace,
 		"event_trace": eventTrace,
-		"state_trace": parseTLCStateTrace(states),
+		"state_trace": states,
 	}
 	dataB, err := json.MarshalIndent(data, "", "\t")
 	if err != nil {
@@ -147,22 +448,6 @@ func (t *TLCStateGuider) recordTrace(as string, trace *Trace, eventTrace *EventT
 	writer.Flush()
 }
 
-func parseTLCStateTrace(states []TLCState) []TLCState {
-	newStates := make([]TLCState, len(states))
-	for i, s := range states {
-		repr := strings.ReplaceAll(s.Repr, "\n", ",")
-		repr = strings.ReplaceAll(repr, "/\\", "")
-		repr = strings.ReplaceAll(repr, "\u003e\u003e", "]")
-		repr = strings.ReplaceAll(repr, "\u003c\u003c", "[")
-		repr = strings.ReplaceAll(repr, "\u003e", ">")
-		newStates[i] = TLCState{
-			Repr: repr,
-			Key:  s.Key,
-		}
-	}
-	return newStates
-}
-
 type TraceCoverageGuider struct {
 	traces map[string]bool
 	*TLCStateGuider
@@ -170,25 +455,24 @@ type TraceCoverageGuider struct {
 
 var _ Guider = &TraceCoverageGuider{}
 
-func NewTraceCoverageGuider(tlcAddr, recordPath string, jacocoFile string, jacocoOutput string) *TraceCoverageGuider {
+func NewTraceCoverageGuider(config GuiderConfig) *TraceCoverageGuider {
 	return &TraceCoverageGuider{
 		traces:         make(map[string]bool),
-		TLCStateGuider: NewTLCStateGuider(tlcAddr, recordPath, jacocoFile, jacocoOutput),
+		TLCStateGuider: NewTLCStateGuider(config),
 	}
 }
 
-func (t *TraceCoverageGuider) Check(iter string, trace *Trace, events *EventTrace, record bool) (bool, int, int, int) {
-	t.TLCStateGuider.Check(iter, trace, events, record)
+func (t *TraceCoverageGuider) Check(iter int, trace *Trace, events *EventTrace, record bool) CheckResult {
+	result := t.TLCStateGuider.Check(iter, trace, events, record)
 
 	eTrace := newEventTrace(events)
 	key := eTrace.Hash()
 
-	new := 0
 	if _, ok := t.traces[key]; !ok {
 		t.traces[key] = true
-		new = 1
+		result.NewTraces = 1
 	}
-	return new != 0, new, 0, 0
+	return result
 }
 
 func (t *TraceCoverageGuider) Coverage() int {
@@ -253,13 +537,55 @@ func newEventTrace(events *EventTrace) *eventTrace {
 }
 
 // ------- Functions for code coverage -------
+
+// Probe is a JaCoCo probe identified by its class id and index
+type Probe struct {
+	Class uint64
+	Index int
+}
+
+// readProbes reads the execution data in the exec file, the probes hit and
+// whether any of them were not hit before. Lines can only be newly covered
+// when new probes were hit, so the XML report only needs to be generated in
+// that case. Reports true along with the error if the exec file cannot be
+// read, falling back to the XML report.
+func (t *TLCStateGuider) readProbes() (map[uint64]*ExecutionData, []Probe, bool, error) {
+	data, err := ReadExecFile(t.jacocoFile)
+	if err != nil {
+		return nil, nil, true, err
+	}
+	hit := make([]Probe, 0)
+	found := false
+	for id, class := range data {
+		seen, ok := t.probes[id]
+		if !ok || len(seen) != len(class.Probes) {
+			seen = make([]bool, len(class.Probes))
+			t.probes[id] = seen
+		}
+		for i, p := range class.Probes {
+			if !p {
+				continue
+			}
+			hit = append(hit, Probe{Class: id, Index: i})
+			if !seen[i] {
+				seen[i] = true
+				found = true
+			}
+		}
+	}
+	return data, hit, found, nil
+}
+
 func (t *TLCStateGuider) generateXMLReport() error {
-	cmd := exec.Command("java", "-jar", "jacococli.jar", "report", t.jacocoFile,
-		"--classfiles", "../xraft-controlled/xraft-core/target/classes",
-		"--classfiles", "../xraft-controlled/xraft-kvstore/target/classes",
-		"--sourcefiles", "../xraft-controlled/xraft-core/src/main/java",
-		"--sourcefiles", "../xraft-controlled/xraft-kvstore/src/main/java",
-		"--xml", t.jacocoOutput)
+	args := []string{"-jar", "jacococli.jar", "report", t.jacocoFile}
+	for _, dir := range t.codeCoverage.ClassDirs {
+		args = append(args, "--classfiles", dir)
+	}
+	for _, dir := range t.codeCoverage.SourceDirs {
+		args = append(args, "--sourcefiles", dir)
+	}
+	args = append(args, "--xml", t.jacocoOutput)
+	cmd := exec.Command("java", args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
@@ -273,15 +599,83 @@ type Line struct {
 	CoveredBranches int `xml:"cb,attr"`
 }
 
-var coverageData = map[string]map[int]struct{}{}
+// coverageData holds the iteration that first covered each line
+var coverageData = map[string]map[int]int{}
+
+// branchData holds the branches of each line whose probes fired
+var branchData = map[string]map[int]map[Branch]bool{}
+
+// lineData holds the branches of every line known to the reports. Lines only
+// known from the JaCoCo report have no branches, as the report does not tell
+// which of them were covered.
+var lineData = map[string]map[int][]Branch{}
+
+// addCoverageFile creates the coverage data of a source file
+func addCoverageFile(file string) {
+	if _, ok := coverageData[file]; !ok {
+		coverageData[file] = map[int]int{}
+		branchData[file] = map[int]map[Branch]bool{}
+		lineData[file] = map[int][]Branch{}
+	}
+}
+
+// registerLines adds the lines of the analyzed classes to the line data, so
+// that lines that are never covered are reported too
+func registerLines(table *ProbeTable) {
+	for _, class := range table.classes {
+		addCoverageFile(class.File)
+		for n := range class.Lines {
+			lineData[class.File][n] = append(lineData[class.File][n], class.Branches[n]...)
+		}
+	}
+}
+
+// updateCoverage adds the lines and branches covered by an iteration to the
+// global coverage data and returns the lines that were not covered before and
+// the number of newly covered branches
+func updateCoverage(lines []CoveredLine, branches []Branch, iteration int) ([]CoveredLine, int) {
+	newLines := make([]CoveredLine, 0)
+	for _, l := range lines {
+		addCoverageFile(l.File)
+		if _, ok := coverageData[l.File][l.Line]; !ok {
+			coverageData[l.File][l.Line] = iteration
+			newLines = append(newLines, l)
+		}
+	}
+
+	newBranches := 0
+	for _, b := range branches {
+		addCoverageFile(b.File)
+		if _, ok := branchData[b.File][b.Line]; !ok {
+			branchData[b.File][b.Line] = make(map[Branch]bool)
+		}
+		if !branchData[b.File][b.Line][b] {
+			branchData[b.File][b.Line][b] = true
+			newBranches++
+		}
+	}
+	return newLines, newBranches
+}
 
 type SourceFile struct {
 	Name  string `xml:"name,attr"`
 	Lines []Line `xml:"line"`
 }
 
+type Method struct {
+	Name string `xml:"name,attr"`
+	Line int    `xml:"line,attr"`
+}
+
+type Class struct {
+	Name           string   `xml:"name,attr"`
+	SourceFileName string   `xml:"sourcefilename,attr"`
+	Methods        []Method `xml:"method"`
+}
+
 type Package struct {
 	Name        string       `xml:"name,attr"`
+	Classes     []Class      `xml:"class"`
 	SourceFiles []SourceFile `xml:"sourcefile"`
 }
 
@@ -289,39 +683,128 @@ type Report struct {
 	Packages []Package `xml:"package"`
 }
 
-func parseCoverageAndUpdate(path string) (int, error) {
+// CoveredLine is a source line together with the class and method it belongs to
+type CoveredLine struct {
+	File   string
+	Line   int
+	Class  string
+	Method string
+}
+
+// locate returns the class and method a line of a source file of the package
+// belongs to, taking the method that starts closest before the line.
+func (p Package) locate(sourceFile string, line int) (string, string) {
+	class, method := "", ""
+	start := -1
+	for _, c := range p.Classes {
+		if c.SourceFileName != sourceFile {
+			continue
+		}
+		if class == "" {
+			class = c.Name
+		}
+		for _, m := range c.Methods {
+			if m.Line <= line && m.Line > start {
+				class, method, start = c.Name, m.Name, m.Line
+			}
+		}
+	}
+	return class, method
+}
+
+// methodAt returns the method of the class that contains the line
+func (r *Report) methodAt(class string, line int) string {
+	class = strings.ReplaceAll(class, ".", "/")
+	methods := make([]Method, 0)
+	for _, p := range r.Packages {
+		for _, c := range p.Classes {
+			if c.Name == class {
+				methods = append(methods, c.Methods...)
+			}
+		}
+	}
+	return methodAtLine(methods, line)
+}
+
+// methodAtLine returns the method starting last at or before the line, which
+// is the method containing it as methods span the lines up to the next one
+func methodAtLine(methods []Method, line int) string {
+	method := ""
+	start := -1
+	for _, m := range methods {
+		if m.Line <= line && m.Line > start {
+			method, start = m.Name, m.Line
+		}
+	}
+	return method
+}
+
+// coveredLines returns all lines of the report with covered instructions
+func (r *Report) coveredLines() []CoveredLine {
+	lines := make([]CoveredLine, 0)
+	for _, pkg := range r.Packages {
+		for _, src := range pkg.SourceFiles {
+			for _, line := range src.Lines {
+				if line.CoveredInstr == 0 {
+					continue
+				}
+				class, method := pkg.locate(src.Name, line.Number)
+				lines = append(lines, CoveredLine{
+					File:   filepath.Join(pkg.Name, src.Name),
+					Line:   line.Number,
+					Class:  class,
+					Method: method,
+				})
+			}
+		}
+	}
+	return lines
+}
+
+// parseCoverageAndUpdate adds the lines covered in the report of the
+// iteration to the global coverage data and returns the lines that were not
+// covered before. The report only counts the covered branches of a line, so
+// branches are only recorded from the probes.
+func parseCoverageAndUpdate(path string, iteration int) ([]CoveredLine, *Report, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return 0, err
+		return nil, nil, err
 	}
 	defer f.Close()
 
 	var report Report
 	if err := xml.NewDecoder(f).Decode(&report); err != nil {
-		return 0, err
+		return nil, nil, err
 	}
 
-	newLines := 0
+	newLines := make([]CoveredLine, 0)
 
 	for _, pkg := range report.Packages {
 		for _, src := range pkg.SourceFiles {
 			filePath := filepath.Join(pkg.Name, src.Name)
 
-			if _, ok := coverageData[filePath]; !ok {
-				coverageData[filePath] = map[int]struct{}{}
-			}
+			addCoverageFile(filePath)
 
 			for _, line := range src.Lines {
+				if _, ok := lineData[filePath][line.Number]; !ok {
+					lineData[filePath][line.Number] = nil
+				}
 				if line.CoveredInstr > 0 {
 					if _, already := coverageData[filePath][line.Number]; !already {
-						newLines += 1
-						coverageData[filePath][line.Number] = struct{}{}
+						class, method := pkg.locate(src.Name, line.Number)
+						newLines = append(newLines, CoveredLine{
+							File:   filePath,
+							Line:   line.Number,
+							Class:  class,
+							Method: method,
+						})
+						coverageData[filePath][line.Number] = iteration
 					}
 				}
 			}
 		}
 	}
-	return newLines, nil
+	return newLines, &report, nil
 }
 
 func CoverageDataLength() int {
@@ -331,3 +814,14 @@ func CoverageDataLength() int {
 	}
 	return count
 }
+
+// BranchDataLength returns the number of branches covered so far
+func BranchDataLength() int {
+	count := 0
+	for _, lines := range branchData {
+		for _, branches := range lines {
+			count += len(branches)
+		}
+	}
+	return count
+}
@@ -0,0 +1,722 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc64"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ClassAnalysis maps the probes the JaCoCo agent inserts into a class to the
+// source lines and branches they cover. Probes are numbered the way JaCoCo
+// numbers them, so the probes of the class in an exec file index Probes.
+//
+// Methods JaCoCo filters from its reports as a whole (synthetic methods other
+// than lambdas, bridges, enum values and valueOf and private empty
+// constructors) cover no lines. The filters that only drop or merge parts of
+// a method, e.g. for finally blocks, are not applied.
+type ClassAnalysis struct {
+	ID uint64
+	// Internal name, e.g. org/apache/ratis/server/impl/RaftServerImpl
+	Name string
+	// Source file relative to the source directories
+	File    string
+	Methods []Method
+	// Method of every line with instructions
+	Lines map[int]string
+	// Branches of every line with instructions that have several successors
+	Branches map[int][]Branch
+	Probes   []ProbeCoverage
+}
+
+// ProbeCoverage holds the lines and branches a probe covers when it fired
+type ProbeCoverage struct {
+	Lines    []int
+	Branches []Branch
+}
+
+// Branch is an outcome of an instruction with several successors.
+// Instructions are numbered per class.
+type Branch struct {
+	File        string
+	Line        int
+	Class       string
+	Instruction int
+	Index       int
+}
+
+// ProbeTable holds the analyses of the classes in the class directories by class id
+type ProbeTable struct {
+	classes map[uint64]*ClassAnalysis
+	// Classes that could not be analyzed
+	failed map[string]bool
+}
+
+// AnalyzeClasses analyzes the class files in the directories
+func AnalyzeClasses(dirs []string) *ProbeTable {
+	table := &ProbeTable{
+		classes: make(map[uint64]*ClassAnalysis),
+		failed:  make(map[string]bool),
+	}
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(p, ".class") {
+				return nil
+			}
+			b, err := os.ReadFile(p)
+			if err != nil {
+				return nil
+			}
+			analysis, err := AnalyzeClass(b)
+			if err != nil {
+				name, _ := filepath.Rel(dir, strings.TrimSuffix(p, ".class"))
+				table.failed[filepath.ToSlash(name)] = true
+			} else if analysis != nil {
+				table.classes[analysis.ID] = analysis
+			}
+			return nil
+		})
+	}
+	return table
+}
+
+// Map returns the lines and branches covered by the probes of the execution
+// data. Classes outside the class directories are skipped, as are classes
+// whose id does not match their class file, like in the JaCoCo report. Reports
+// false if a class with probes hit could not be analyzed.
+func (p *ProbeTable) Map(data map[uint64]*ExecutionData) ([]CoveredLine, []Branch, bool) {
+	if data == nil {
+		return nil, nil, false
+	}
+	lines := make([]CoveredLine, 0)
+	branches := make([]Branch, 0)
+	seenLines := make(map[string]bool)
+	seenBranches := make(map[Branch]bool)
+	for id, execution := range data {
+		class, ok := p.classes[id]
+		if !ok {
+			if p.failed[execution.Name] {
+				return nil, nil, false
+			}
+			continue
+		}
+		if len(class.Probes) != len(execution.Probes) {
+			return nil, nil, false
+		}
+		for i, hit := range execution.Probes {
+			if !hit {
+				continue
+			}
+			for _, n := range class.Probes[i].Lines {
+				key := fmt.Sprintf("%s:%d", class.File, n)
+				if !seenLines[key] {
+					seenLines[key] = true
+					lines = append(lines, CoveredLine{File: class.File, Line: n, Class: class.Name, Method: class.Lines[n]})
+				}
+			}
+			for _, b := range class.Probes[i].Branches {
+				if !seenBranches[b] {
+					seenBranches[b] = true
+					branches = append(branches, b)
+				}
+			}
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		if lines[i].File != lines[j].File {
+			return lines[i].File < lines[j].File
+		}
+		return lines[i].Line < lines[j].Line
+	})
+	return lines, branches, true
+}
+
+// methodAt returns the method of the class that contains the line
+func (p *ProbeTable) methodAt(class string, line int) string {
+	class = strings.ReplaceAll(class, ".", "/")
+	methods := make([]Method, 0)
+	for _, c := range p.classes {
+		if c.Name == class {
+			methods = append(methods, c.Methods...)
+		}
+	}
+	return methodAtLine(methods, line)
+}
+
+// classID returns the id JaCoCo assigns to a class, the CRC64 checksum of its
+// class file. Java 9 class files are hashed with the Java 8 version number as
+// JaCoCo does.
+func classID(b []byte) uint64 {
+	table := crc64.MakeTable(crc64.ISO)
+	sum := uint64(0)
+	for i, c := range b {
+		if i == 7 && b[6] == 0 && c == 53 {
+			c = 52
+		}
+		sum = (sum >> 8) ^ table[byte(sum)^c]
+	}
+	return sum
+}
+
+// Access flags of classes and methods
+const (
+	accPrivate   = 0x0002
+	accBridge    = 0x0040
+	accSynthetic = 0x1000
+	accModule    = 0x8000
+)
+
+// AnalyzeClass analyzes a class file. Returns nil for classes JaCoCo does not
+// report, i.e. synthetic classes and module descriptors.
+func AnalyzeClass(b []byte) (*ClassAnalysis, error) {
+	class, err := parseClassFile(b)
+	if err != nil {
+		return nil, err
+	}
+	if class.access&(accSynthetic|accModule) != 0 {
+		return nil, nil
+	}
+
+	file := class.sourceFile
+	if dir := path.Dir(class.name); dir != "." {
+		file = dir + "/" + file
+	}
+	analysis := &ClassAnalysis{
+		ID:       classID(b),
+		Name:     class.name,
+		File:     file,
+		Methods:  make([]Method, 0),
+		Lines:    make(map[int]string),
+		Branches: make(map[int][]Branch),
+	}
+
+	probes := 0
+	graphs := make([]*methodGraph, len(class.methods))
+	for i, m := range class.methods {
+		if graphs[i], err = analyzeMethod(m, &probes); err != nil {
+			return nil, fmt.Errorf("error analyzing %s.%s: %s", class.name, m.name, err)
+		}
+	}
+
+	analysis.Probes = make([]ProbeCoverage, probes)
+	offset := 0
+	for i, m := range class.methods {
+		g := graphs[i]
+		if class.filtered(m) {
+			offset += len(g.lines)
+			continue
+		}
+
+		first := -1
+		for insn, line := range g.lines {
+			if line < 0 {
+				continue
+			}
+			if first < 0 || line < first {
+				first = line
+			}
+			if _, ok := analysis.Lines[line]; !ok {
+				analysis.Lines[line] = m.name
+			}
+			if len(g.branches[insn]) < 2 {
+				continue
+			}
+			for _, index := range g.branches[insn] {
+				analysis.Branches[line] = append(analysis.Branches[line], Branch{
+					File:        file,
+					Line:        line,
+					Class:       class.name,
+					Instruction: offset + insn,
+					Index:       index,
+				})
+			}
+		}
+		if first >= 0 {
+			analysis.Methods = append(analysis.Methods, Method{Name: m.name, Line: first})
+		}
+
+		for _, probe := range g.probes {
+			coverage := ProbeCoverage{Lines: make([]int, 0), Branches: make([]Branch, 0)}
+			seen := make(map[int]bool)
+			for insn, covered := range g.cover(probe) {
+				line := g.lines[insn]
+				if len(covered) == 0 || line < 0 {
+					continue
+				}
+				if !seen[line] {
+					seen[line] = true
+					coverage.Lines = append(coverage.Lines, line)
+				}
+				if len(g.branches[insn]) < 2 {
+					continue
+				}
+				for _, index := range g.branches[insn] {
+					if covered[index] {
+						coverage.Branches = append(coverage.Branches, Branch{
+							File:        file,
+							Line:        line,
+							Class:       class.name,
+							Instruction: offset + insn,
+							Index:       index,
+						})
+					}
+				}
+			}
+			sort.Ints(coverage.Lines)
+			analysis.Probes[probe] = coverage
+		}
+		offset += len(g.lines)
+	}
+	return analysis, nil
+}
+
+// filtered reports whether JaCoCo drops the method from its reports
+func (c *classFile) filtered(m *methodInfo) bool {
+	if m.access&accSynthetic != 0 && !strings.HasPrefix(m.name, "lambda$") {
+		return true
+	}
+	if m.access&accBridge != 0 {
+		return true
+	}
+	if c.superName == "java/lang/Enum" {
+		if (m.name == "values" && m.desc == "()[L"+c.name+";") || (m.name == "valueOf" && m.desc == "(Ljava/lang/String;)L"+c.name+";") {
+			return true
+		}
+	}
+	if m.access&accPrivate != 0 && m.name == "<init>" && m.desc == "()V" && len(m.code) == 5 &&
+		m.code[0] == opAload0 && m.code[1] == opInvokeSpecial && m.code[4] == opReturn {
+		owner, name, desc := c.methodRef(int(m.code[2])<<8 | int(m.code[3]))
+		return owner == c.superName && name == "<init>" && desc == "()V"
+	}
+	return false
+}
+
+// Opcodes that affect the control flow or the placement of probes
+const (
+	opAload0         = 0x2a
+	opIfeq           = 0x99
+	opGoto           = 0xa7
+	opJsr            = 0xa8
+	opRet            = 0xa9
+	opTableSwitch    = 0xaa
+	opLookupSwitch   = 0xab
+	opIreturn        = 0xac
+	opReturn         = 0xb1
+	opInvokeVirtual  = 0xb6
+	opInvokeSpecial  = 0xb7
+	opInvokeDynamic  = 0xba
+	opAthrow         = 0xbf
+	opWide           = 0xc4
+	opIfnull         = 0xc6
+	opIfnonnull      = 0xc7
+	opGotoW          = 0xc8
+	opJsrW           = 0xc9
+	opIinc           = 0x84
+	opMultiANewArray = 0xc5
+)
+
+// instruction is a decoded bytecode instruction. Targets holds the offsets of
+// jump targets, for switches the default target first.
+type instruction struct {
+	offset  int
+	opcode  byte
+	targets []int
+}
+
+func (i instruction) isReturn() bool {
+	return (i.opcode >= opIreturn && i.opcode <= opReturn) || i.opcode == opAthrow
+}
+
+func (i instruction) isJump() bool {
+	return (i.opcode >= opIfeq && i.opcode <= opGoto) || i.opcode == opIfnull || i.opcode == opIfnonnull || i.opcode == opGotoW
+}
+
+func (i instruction) isGoto() bool {
+	return i.opcode == opGoto || i.opcode == opGotoW
+}
+
+func (i instruction) isSwitch() bool {
+	return i.opcode == opTableSwitch || i.opcode == opLookupSwitch
+}
+
+func (i instruction) isInvoke() bool {
+	return i.opcode >= opInvokeVirtual && i.opcode <= opInvokeDynamic
+}
+
+// instructionLengths holds the length of every instruction of fixed length, 0 for invalid opcodes
+var instructionLengths = func() [256]int {
+	var lengths [256]int
+	for op := 0x00; op <= 0xc9; op++ {
+		lengths[op] = 1
+	}
+	for _, op := range []int{0x10, 0x12, 0x15, 0x16, 0x17, 0x18, 0x19, 0x36, 0x37, 0x38, 0x39, 0x3a, 0xa9, 0xbc} {
+		lengths[op] = 2
+	}
+	for _, op := range []int{0x11, 0x13, 0x14, 0x84, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, 0xbb, 0xbd, 0xc0, 0xc1} {
+		lengths[op] = 3
+	}
+	for op := opIfeq; op <= opJsr; op++ {
+		lengths[op] = 3
+	}
+	lengths[opIfnull], lengths[opIfnonnull] = 3, 3
+	lengths[opMultiANewArray] = 4
+	lengths[0xb9], lengths[opInvokeDynamic] = 5, 5
+	lengths[opGotoW], lengths[opJsrW] = 5, 5
+	return lengths
+}()
+
+// decodeInstructions splits the code of a method into instructions
+func decodeInstructions(code []byte) ([]instruction, error) {
+	insns := make([]instruction, 0)
+	r := &classReader{b: code}
+	for r.pos < len(code) && r.err == nil {
+		offset := r.pos
+		op := byte(r.u1())
+		insn := instruction{offset: offset, opcode: op}
+		switch {
+		case op == opJsr || op == opJsrW || op == opRet:
+			return nil, fmt.Errorf("subroutines are not supported")
+		case op == opWide:
+			switch byte(r.u1()) {
+			case opRet:
+				return nil, fmt.Errorf("subroutines are not supported")
+			case opIinc:
+				r.skip(4)
+			default:
+				r.skip(2)
+			}
+		case op == opGotoW:
+			insn.targets = []int{offset + int(int32(r.u4()))}
+		case insn.isJump():
+			insn.targets = []int{offset + int(int16(r.u2()))}
+		case insn.isSwitch():
+			r.skip((4 - r.pos%4) % 4)
+			insn.targets = []int{offset + int(int32(r.u4()))}
+			if op == opTableSwitch {
+				low, high := int(int32(r.u4())), int(int32(r.u4()))
+				for i := low; i <= high && r.err == nil; i++ {
+					insn.targets = append(insn.targets, offset+int(int32(r.u4())))
+				}
+			} else {
+				pairs := int(int32(r.u4()))
+				for i := 0; i < pairs && r.err == nil; i++ {
+					r.skip(4)
+					insn.targets = append(insn.targets, offset+int(int32(r.u4())))
+				}
+			}
+		case instructionLengths[op] == 0:
+			return nil, fmt.Errorf("invalid opcode %#x at %d", op, offset)
+		default:
+			r.skip(instructionLengths[op] - 1)
+		}
+		insns = append(insns, insn)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	for _, insn := range insns {
+		for _, target := range insn.targets {
+			if target < 0 || target >= len(code) {
+				return nil, fmt.Errorf("jump target %d out of range", target)
+			}
+		}
+	}
+	return insns, nil
+}
+
+// labelInfo holds the flow information JaCoCo attaches to a bytecode offset
+// that is referenced by jumps, exception handlers or debug information
+type labelInfo struct {
+	target               bool
+	successor            bool
+	multiTarget          bool
+	methodInvocationLine bool
+	done                 bool
+	probe                int
+	instruction          int
+}
+
+func (l *labelInfo) setTarget() {
+	if l.target || l.successor {
+		l.multiTarget = true
+	} else {
+		l.target = true
+	}
+}
+
+func (l *labelInfo) setSuccessor() {
+	l.successor = true
+	if l.target {
+		l.multiTarget = true
+	}
+}
+
+func (l *labelInfo) needsProbe() bool {
+	return l.successor && (l.multiTarget || l.methodInvocationLine)
+}
+
+// methodGraph holds the instructions of a method and the edges between them
+// in the order JaCoCo adds them, so the coverage resulting from a probe can
+// be propagated the way JaCoCo does
+type methodGraph struct {
+	// Line of every instruction, -1 if unknown
+	lines []int
+	// Indices of the branches of every instruction
+	branches [][]int
+	edges    []edge
+	// Ids of the probes of the method
+	probes []int
+}
+
+// edge is a branch of an instruction to another instruction or, if probe is
+// set, to the probe inserted on the branch
+type edge struct {
+	from, to int
+	branch   int
+	probe    int
+}
+
+// analyzeMethod assigns the probes of the method, numbering them from
+// probes, and builds its instruction graph. This follows JaCoCo's
+// LabelFlowAnalyzer, MethodProbesAdapter and InstructionsBuilder.
+func analyzeMethod(m *methodInfo, probes *int) (*methodGraph, error) {
+	g := &methodGraph{lines: make([]int, 0), branches: make([][]int, 0), edges: make([]edge, 0), probes: make([]int, 0)}
+	if m.code == nil {
+		return g, nil
+	}
+	insns, err := decodeInstructions(m.code)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[int]*labelInfo)
+	label := func(offset int) *labelInfo {
+		l, ok := labels[offset]
+		if !ok {
+			l = &labelInfo{probe: -1, instruction: -1}
+			labels[offset] = l
+		}
+		return l
+	}
+	for _, insn := range insns {
+		for _, target := range insn.targets {
+			label(target)
+		}
+	}
+	for _, h := range m.handlers {
+		label(h.start)
+		label(h.end)
+		label(h.handler)
+	}
+	lines := make(map[int][]int)
+	for _, l := range m.lines {
+		label(l.offset)
+		lines[l.offset] = append(lines[l.offset], l.line)
+	}
+	for _, offset := range m.debugLabels {
+		label(offset)
+	}
+
+	// Mark jump targets and successors
+	for i := len(m.handlers) - 1; i >= 0; i-- {
+		label(m.handlers[i].start).setTarget()
+		label(m.handlers[i].handler).setTarget()
+	}
+	successor, first := false, true
+	var lineStart *labelInfo
+	visitLabel := func(offset int) {
+		l, ok := labels[offset]
+		if !ok {
+			return
+		}
+		if first {
+			l.setTarget()
+		}
+		if successor {
+			l.setSuccessor()
+		}
+		if _, ok := lines[offset]; ok {
+			lineStart = l
+		}
+	}
+	for _, insn := range insns {
+		visitLabel(insn.offset)
+		switch {
+		case insn.isJump():
+			labels[insn.targets[0]].setTarget()
+			successor = !insn.isGoto()
+		case insn.isSwitch():
+			for _, target := range insn.targets {
+				labels[target].done = false
+			}
+			for _, target := range insn.targets {
+				if l := labels[target]; !l.done {
+					l.setTarget()
+					l.done = true
+				}
+			}
+			successor = false
+		case insn.isReturn():
+			successor = false
+		default:
+			successor = true
+			if insn.isInvoke() && lineStart != nil {
+				lineStart.methodInvocationLine = true
+			}
+		}
+		first = false
+	}
+	visitLabel(len(m.code))
+
+	// Insert probes and build the instruction graph
+	nextProbe := func() int {
+		id := *probes
+		*probes++
+		g.probes = append(g.probes, id)
+		return id
+	}
+	current, line := -1, -1
+	pending := make([]*labelInfo, 0)
+	jumps := make([]edge, 0)
+	addProbe := func(from, branch, probe int) {
+		if from >= 0 {
+			g.edges = append(g.edges, edge{from: from, to: -1, branch: branch, probe: probe})
+		}
+	}
+	addLabel := func(offset int) {
+		l, ok := labels[offset]
+		if !ok {
+			return
+		}
+		if l.needsProbe() {
+			addProbe(current, 0, nextProbe())
+			current = -1
+		}
+		pending = append(pending, l)
+		if !l.successor {
+			current = -1
+		}
+	}
+	for _, insn := range insns {
+		addLabel(insn.offset)
+		if l, ok := lines[insn.offset]; ok {
+			line = l[len(l)-1]
+		}
+
+		i := len(g.lines)
+		g.lines = append(g.lines, line)
+		for _, l := range pending {
+			l.instruction = i
+		}
+		pending = pending[:0]
+		if current >= 0 {
+			g.edges = append(g.edges, edge{from: current, to: i, branch: 0, probe: -1})
+		}
+		current = i
+
+		switch {
+		case insn.isReturn():
+			addProbe(i, 0, nextProbe())
+		case insn.isJump():
+			if labels[insn.targets[0]].multiTarget {
+				addProbe(i, 1, nextProbe())
+			} else {
+				jumps = append(jumps, edge{from: i, to: insn.targets[0], branch: 1, probe: -1})
+			}
+		case insn.isSwitch():
+			dflt, cases := labels[insn.targets[0]], insn.targets[1:]
+			withProbes := false
+			for _, target := range cases {
+				labels[target].done = false
+			}
+			if dflt.multiTarget {
+				dflt.probe = nextProbe()
+				withProbes = true
+			}
+			dflt.done = true
+			for _, target := range cases {
+				if l := labels[target]; l.multiTarget && !l.done {
+					l.probe = nextProbe()
+					withProbes = true
+				}
+				labels[target].done = true
+			}
+
+			for _, target := range insn.targets {
+				labels[target].done = false
+			}
+			branch := 0
+			for j, target := range insn.targets {
+				l := labels[target]
+				if withProbes && j > 0 {
+					branch++
+				}
+				if l.done {
+					continue
+				}
+				if !withProbes && j > 0 {
+					branch++
+				}
+				if withProbes && l.probe >= 0 {
+					addProbe(i, branch, l.probe)
+				} else {
+					jumps = append(jumps, edge{from: i, to: target, branch: branch, probe: -1})
+				}
+				l.done = true
+			}
+		}
+	}
+	addLabel(len(m.code))
+
+	for _, j := range jumps {
+		if to := labels[j.to].instruction; to >= 0 {
+			g.edges = append(g.edges, edge{from: j.from, to: to, branch: j.branch, probe: -1})
+		}
+	}
+
+	g.branches = make([][]int, len(g.lines))
+	for _, e := range g.edges {
+		g.branches[e.from] = append(g.branches[e.from], e.branch)
+	}
+	return g, nil
+}
+
+// cover returns the branches of every instruction covered when only the
+// probe fired. As in JaCoCo an executed branch covers its instruction and
+// the chain of predecessors until an instruction that is already covered.
+func (g *methodGraph) cover(probe int) []map[int]bool {
+	covered := make([]map[int]bool, len(g.lines))
+	predecessor := make([]int, len(g.lines))
+	predecessorBranch := make([]int, len(g.lines))
+	for i := range predecessor {
+		predecessor[i] = -1
+	}
+	propagate := func(insn, branch int) {
+		for insn >= 0 {
+			if len(covered[insn]) > 0 {
+				covered[insn][branch] = true
+				return
+			}
+			covered[insn] = map[int]bool{branch: true}
+			insn, branch = predecessor[insn], predecessorBranch[insn]
+		}
+	}
+	for _, e := range g.edges {
+		if e.to < 0 {
+			if e.probe == probe {
+				propagate(e.from, e.branch)
+			}
+			continue
+		}
+		predecessor[e.to] = e.from
+		predecessorBranch[e.to] = e.branch
+		if len(covered[e.to]) > 0 {
+			propagate(e.from, e.branch)
+		}
+	}
+	return covered
+}
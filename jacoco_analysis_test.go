@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type testMethod struct {
+	access int
+	name   string
+	desc   string
+	code   []byte
+	// Pairs of bytecode offset and line
+	lines [][2]int
+}
+
+// classBuilder assembles class files for the tests
+type classBuilder struct {
+	pool  bytes.Buffer
+	count int
+	utf8s map[string]int
+}
+
+func (c *classBuilder) add(tag byte, refs ...int) int {
+	c.pool.WriteByte(tag)
+	for _, ref := range refs {
+		binary.Write(&c.pool, binary.BigEndian, uint16(ref))
+	}
+	c.count++
+	return c.count
+}
+
+func (c *classBuilder) utf8(s string) int {
+	if index, ok := c.utf8s[s]; ok {
+		return index
+	}
+	c.pool.WriteByte(constantUtf8)
+	binary.Write(&c.pool, binary.BigEndian, uint16(len(s)))
+	c.pool.WriteString(s)
+	c.count++
+	c.utf8s[s] = c.count
+	return c.count
+}
+
+// buildClass assembles the class Test extending Object, whose class entry is
+// at index 2 of the constant pool. Index 1 refers to Object.<init>.
+func buildClass(major int, methods []testMethod) []byte {
+	c := &classBuilder{utf8s: make(map[string]int)}
+	c.add(constantMethodref, 2, 4)
+	c.add(constantClass, 3)
+	c.utf8("java/lang/Object")
+	c.add(constantNameAndType, 5, 6)
+	c.utf8("<init>")
+	c.utf8("()V")
+	this := c.add(constantClass, c.utf8("Test"))
+	code, lineTable, sourceFile := c.utf8("Code"), c.utf8("LineNumberTable"), c.utf8("SourceFile")
+	source := c.utf8("Test.java")
+
+	var body bytes.Buffer
+	w := func(values ...int) {
+		for _, v := range values {
+			binary.Write(&body, binary.BigEndian, uint16(v))
+		}
+	}
+	w(0x21, this, 2, 0, 0, len(methods))
+	for _, m := range methods {
+		w(m.access, c.utf8(m.name), c.utf8(m.desc), 1, code)
+		lines := 2 + 4*len(m.lines)
+		binary.Write(&body, binary.BigEndian, uint32(12+len(m.code)+6+lines))
+		w(4, 4)
+		binary.Write(&body, binary.BigEndian, uint32(len(m.code)))
+		body.Write(m.code)
+		w(0, 1, lineTable)
+		binary.Write(&body, binary.BigEndian, uint32(lines))
+		w(len(m.lines))
+		for _, l := range m.lines {
+			w(l[0], l[1])
+		}
+	}
+	w(1, sourceFile)
+	binary.Write(&body, binary.BigEndian, uint32(2))
+	w(source)
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(0xCAFEBABE))
+	binary.Write(&b, binary.BigEndian, [2]uint16{0, uint16(major)})
+	binary.Write(&b, binary.BigEndian, uint16(c.count+1))
+	b.Write(c.pool.Bytes())
+	b.Write(body.Bytes())
+	return b.Bytes()
+}
+
+var testMethods = []testMethod{
+	// Test() { super(); }
+	{0x1, "<init>", "()V", []byte{0x2a, 0xb7, 0x00, 0x01, 0xb1}, [][2]int{{0, 1}}},
+	// static int f(int x) { if (x == 0) return 1; return 2; }
+	{0x8, "f", "(I)I", []byte{0x1a, 0x9a, 0x00, 0x05, 0x04, 0xac, 0x05, 0xac}, [][2]int{{0, 3}, {4, 4}, {6, 5}}},
+	// static void g(int n) { while (n > 0) n--; }
+	{0x8, "g", "(I)V", []byte{0x1a, 0x9e, 0x00, 0x09, 0x84, 0x00, 0xff, 0xa7, 0xff, 0xf9, 0xb1}, [][2]int{{0, 8}, {4, 9}, {10, 10}}},
+	// static void h() { a(); b(); }
+	{0x8, "h", "()V", []byte{0xb8, 0x00, 0x01, 0xb8, 0x00, 0x01, 0xb1}, [][2]int{{0, 20}, {3, 21}, {6, 22}}},
+	// static int s(int x) { switch (x) { case 1: case 2: return 1; default: return 0; } }
+	{0x8, "s", "(I)I", []byte{
+		0x1a,
+		0xab, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x1d,
+		0x00, 0x00, 0x00, 0x02,
+		0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x1b,
+		0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x1b,
+		0x04, 0xac,
+		0x03, 0xac,
+	}, [][2]int{{0, 40}, {28, 41}, {30, 42}}},
+	// Synthetic accessor, filtered by JaCoCo
+	{0x1008, "access$000", "()V", []byte{0xb1}, [][2]int{{0, 30}}},
+}
+
+func TestAnalyzeClass(t *testing.T) {
+	b := buildClass(52, testMethods)
+	analysis, err := AnalyzeClass(b)
+	if err != nil {
+		t.Fatalf("AnalyzeClass() error = %v", err)
+	}
+	if analysis.Name != "Test" || analysis.File != "Test.java" || analysis.ID != classID(b) {
+		t.Errorf("AnalyzeClass() = %s in %s with id %d", analysis.Name, analysis.File, analysis.ID)
+	}
+
+	branch := func(line, insn, index int) Branch {
+		return Branch{File: "Test.java", Line: line, Class: "Test", Instruction: insn, Index: index}
+	}
+	want := []ProbeCoverage{
+		// Return of the constructor
+		{Lines: []int{1}, Branches: []Branch{}},
+		// Returns of f, taking either branch of the ifne at instruction 4
+		{Lines: []int{3, 4}, Branches: []Branch{branch(3, 4, 0)}},
+		{Lines: []int{3, 5}, Branches: []Branch{branch(3, 4, 1)}},
+		// Goto of the loop in g, whose target is also reached from the method start
+		{Lines: []int{8, 9}, Branches: []Branch{branch(8, 10, 0)}},
+		{Lines: []int{8, 10}, Branches: []Branch{branch(8, 10, 1)}},
+		// Probe before the second line of h, which starts with a method invocation
+		{Lines: []int{20}, Branches: []Branch{}},
+		{Lines: []int{21, 22}, Branches: []Branch{}},
+		// Returns of the switch cases in s
+		{Lines: []int{40, 41}, Branches: []Branch{branch(40, 18, 1)}},
+		{Lines: []int{40, 42}, Branches: []Branch{branch(40, 18, 0)}},
+		// Synthetic accessor
+		{},
+	}
+	if !reflect.DeepEqual(analysis.Probes, want) {
+		t.Errorf("AnalyzeClass() probes =\n%v\nwant\n%v", analysis.Probes, want)
+	}
+
+	if _, ok := analysis.Lines[30]; ok {
+		t.Errorf("AnalyzeClass() reports lines of the filtered synthetic method")
+	}
+	if got := analysis.Lines[9]; got != "g" {
+		t.Errorf("method of line 9 = %s, want g", got)
+	}
+	for line, n := range map[int]int{3: 2, 8: 2, 40: 2, 4: 0, 20: 0} {
+		if got := len(analysis.Branches[line]); got != n {
+			t.Errorf("line %d has %d branches, want %d", line, got, n)
+		}
+	}
+	wantMethods := []Method{{"<init>", 1}, {"f", 3}, {"g", 8}, {"h", 20}, {"s", 40}}
+	if !reflect.DeepEqual(analysis.Methods, wantMethods) {
+		t.Errorf("AnalyzeClass() methods = %v, want %v", analysis.Methods, wantMethods)
+	}
+}
+
+func TestAnalyzeClassPrivateConstructor(t *testing.T) {
+	// private Test() { super(); } as in utility classes
+	private := testMethod{0x2, "<init>", "()V", testMethods[0].code, [][2]int{{0, 50}}}
+	b := buildClass(52, []testMethod{private})
+	c, err := parseClassFile(b)
+	if err != nil {
+		t.Fatalf("parseClassFile() error = %v", err)
+	}
+	if c.superName != "java/lang/Object" {
+		t.Fatalf("super class = %q, want java/lang/Object", c.superName)
+	}
+	if !c.filtered(c.methods[0]) {
+		t.Errorf("private empty constructor not filtered")
+	}
+
+	analysis, err := AnalyzeClass(b)
+	if err != nil {
+		t.Fatalf("AnalyzeClass() error = %v", err)
+	}
+	if len(analysis.Lines) != 0 || !reflect.DeepEqual(analysis.Probes, []ProbeCoverage{{}}) {
+		t.Errorf("AnalyzeClass() reports the private empty constructor: lines %v, probes %v", analysis.Lines, analysis.Probes)
+	}
+
+	// Constructors with arguments or other access are kept
+	for _, m := range []testMethod{testMethods[0], {0x2, "<init>", "(I)V", testMethods[0].code, nil}} {
+		if c.filtered(&methodInfo{access: m.access, name: m.name, desc: m.desc, code: m.code}) {
+			t.Errorf("constructor %s with access %#x filtered", m.desc, m.access)
+		}
+	}
+}
+
+func TestAnalyzeClassErrors(t *testing.T) {
+	jsr := []testMethod{{0x8, "j", "()V", []byte{0xa8, 0x00, 0x03, 0xb1}, nil}}
+	outOfRange := []testMethod{{0x8, "j", "()V", []byte{0xa7, 0x00, 0x10}, nil}}
+	for name, b := range map[string][]byte{
+		"subroutine":        buildClass(52, jsr),
+		"jump out of range": buildClass(52, outOfRange),
+		"truncated":         buildClass(52, testMethods)[:100],
+		"invalid magic":     append([]byte{0, 0, 0, 0}, buildClass(52, testMethods)[4:]...),
+	} {
+		if _, err := AnalyzeClass(b); err == nil {
+			t.Errorf("AnalyzeClass() of %s succeeded", name)
+		}
+	}
+}
+
+func TestClassID(t *testing.T) {
+	java8, java9 := buildClass(52, testMethods), buildClass(53, testMethods)
+	if classID(java8) != classID(java9) {
+		t.Errorf("classID() differs for Java 9 class files")
+	}
+	if classID(java8) == classID(buildClass(55, testMethods)) {
+		t.Errorf("classID() equal for Java 11 class files")
+	}
+	if classID(java8) == classID(buildClass(52, testMethods[:1])) {
+		t.Errorf("classID() equal for different classes")
+	}
+}
+
+func TestProbeTableMap(t *testing.T) {
+	analysis, err := AnalyzeClass(buildClass(52, testMethods))
+	if err != nil {
+		t.Fatalf("AnalyzeClass() error = %v", err)
+	}
+	table := &ProbeTable{
+		classes: map[uint64]*ClassAnalysis{analysis.ID: analysis},
+		failed:  map[string]bool{"Broken": true},
+	}
+	probes := make([]bool, len(analysis.Probes))
+	probes[1], probes[2] = true, true
+
+	lines, branches, ok := table.Map(map[uint64]*ExecutionData{
+		analysis.ID: {ID: analysis.ID, Name: "Test", Probes: probes},
+		// Not in the class directories
+		7: {ID: 7, Name: "other/Library", Probes: []bool{true}},
+	})
+	if !ok {
+		t.Fatalf("Map() failed")
+	}
+	wantLines := []CoveredLine{
+		{File: "Test.java", Line: 3, Class: "Test", Method: "f"},
+		{File: "Test.java", Line: 4, Class: "Test", Method: "f"},
+		{File: "Test.java", Line: 5, Class: "Test", Method: "f"},
+	}
+	if !reflect.DeepEqual(lines, wantLines) {
+		t.Errorf("Map() lines = %v, want %v", lines, wantLines)
+	}
+	if len(branches) != 2 {
+		t.Errorf("Map() branches = %v, want both branches of line 3", branches)
+	}
+	if got := table.methodAt("Test", 9); got != "g" {
+		t.Errorf("methodAt() = %s, want g", got)
+	}
+
+	for name, data := range map[string]map[uint64]*ExecutionData{
+		"unreadable":     nil,
+		"not analyzed":   {8: {ID: 8, Name: "Broken", Probes: []bool{true}}},
+		"probe mismatch": {analysis.ID: {ID: analysis.ID, Name: "Test", Probes: []bool{true}}},
+	} {
+		if _, _, ok := table.Map(data); ok {
+			t.Errorf("Map() of %s execution data succeeded", name)
+		}
+	}
+}
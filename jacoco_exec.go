@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Block types and header of the JaCoCo exec file format
+const (
+	execBlockHeader        byte   = 0x01
+	execBlockSessionInfo   byte   = 0x10
+	execBlockExecutionData byte   = 0x11
+	execMagicNumber        uint16 = 0xC0C0
+	execFormatVersion      uint16 = 0x1007
+)
+
+// ExecutionData holds the probes of a class recorded by the JaCoCo agent
+type ExecutionData struct {
+	ID     uint64
+	Name   string
+	Probes []bool
+}
+
+// ReadExecFile reads the execution data of a JaCoCo exec file keyed by class
+// id. The probes of classes dumped in several sessions are merged.
+func ReadExecFile(path string) (map[uint64]*ExecutionData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return readExec(bufio.NewReader(file))
+}
+
+func readExec(r *bufio.Reader) (map[uint64]*ExecutionData, error) {
+	data := make(map[uint64]*ExecutionData)
+	for {
+		block, err := r.ReadByte()
+		if err == io.EOF {
+			return data, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch block {
+		case execBlockHeader:
+			var magic, version uint16
+			if err := binary.Read(r, binary.BigEndian, &magic); err != nil {
+				return nil, err
+			}
+			if magic != execMagicNumber {
+				return nil, fmt.Errorf("invalid exec file magic number %#x", magic)
+			}
+			if err := binary.Read(r, binary.BigEndian, &version); err != nil {
+				return nil, err
+			}
+			if version != execFormatVersion {
+				return nil, fmt.Errorf("unsupported exec file version %#x", version)
+			}
+		case execBlockSessionInfo:
+			if _, err := readExecUTF(r); err != nil {
+				return nil, err
+			}
+			// Start and dump timestamps
+			var timestamps [2]int64
+			if err := binary.Read(r, binary.BigEndian, &timestamps); err != nil {
+				return nil, err
+			}
+		case execBlockExecutionData:
+			var id uint64
+			if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+				return nil, err
+			}
+			name, err := readExecUTF(r)
+			if err != nil {
+				return nil, err
+			}
+			probes, err := readExecProbes(r)
+			if err != nil {
+				return nil, err
+			}
+			class, ok := data[id]
+			if !ok {
+				data[id] = &ExecutionData{ID: id, Name: name, Probes: probes}
+				continue
+			}
+			if len(class.Probes) != len(probes) {
+				return nil, fmt.Errorf("incompatible probes for class %s", name)
+			}
+			for i, p := range probes {
+				class.Probes[i] = class.Probes[i] || p
+			}
+		default:
+			return nil, fmt.Errorf("unknown exec file block type %#x", block)
+		}
+	}
+}
+
+// readExecUTF reads a string written by Java's DataOutput.writeUTF. Class
+// names are ASCII so the modified UTF-8 encoding needs no conversion.
+func readExecUTF(r *bufio.Reader) (string, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return "", err
+	}
+	b := make([]byte, length)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// readExecVarInt reads an int encoded with 7 bits per byte, least significant first
+func readExecVarInt(r *bufio.Reader) (int, error) {
+	value, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+		shift += 7
+	}
+}
+
+// readExecProbes reads a boolean array packed 8 probes per byte, least significant bit first
+func readExecProbes(r *bufio.Reader) ([]bool, error) {
+	length, err := readExecVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+	probes := make([]bool, length)
+	var b byte
+	for i := range probes {
+		if i%8 == 0 {
+			if b, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+		probes[i] = b&(1<<(i%8)) != 0
+	}
+	return probes, nil
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeExecUTF(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+func writeExecVarInt(b *bytes.Buffer, value int) {
+	for value&^0x7F != 0 {
+		b.WriteByte(byte(value&0x7F | 0x80))
+		value >>= 7
+	}
+	b.WriteByte(byte(value))
+}
+
+func writeExecProbes(b *bytes.Buffer, probes []bool) {
+	writeExecVarInt(b, len(probes))
+	var packed byte
+	for i, p := range probes {
+		if p {
+			packed |= 1 << (i % 8)
+		}
+		if i%8 == 7 || i == len(probes)-1 {
+			b.WriteByte(packed)
+			packed = 0
+		}
+	}
+}
+
+func writeExecHeader(b *bytes.Buffer) {
+	b.WriteByte(execBlockHeader)
+	binary.Write(b, binary.BigEndian, execMagicNumber)
+	binary.Write(b, binary.BigEndian, execFormatVersion)
+}
+
+func writeExecSession(b *bytes.Buffer, id string) {
+	b.WriteByte(execBlockSessionInfo)
+	writeExecUTF(b, id)
+	binary.Write(b, binary.BigEndian, [2]int64{1, 2})
+}
+
+func writeExecData(b *bytes.Buffer, id uint64, name string, probes []bool) {
+	b.WriteByte(execBlockExecutionData)
+	binary.Write(b, binary.BigEndian, id)
+	writeExecUTF(b, name)
+	writeExecProbes(b, probes)
+}
+
+func reader(b *bytes.Buffer) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(b.Bytes()))
+}
+
+func TestReadExecVarInt(t *testing.T) {
+	for _, value := range []int{0, 1, 127, 128, 300, 16383, 16384, 1 << 21} {
+		var b bytes.Buffer
+		writeExecVarInt(&b, value)
+		got, err := readExecVarInt(reader(&b))
+		if err != nil {
+			t.Fatalf("readExecVarInt(%d) error = %v", value, err)
+		}
+		if got != value {
+			t.Errorf("readExecVarInt() = %d, want %d", got, value)
+		}
+	}
+}
+
+func TestReadExecProbes(t *testing.T) {
+	many := make([]bool, 200)
+	for i := range many {
+		many[i] = i%3 == 0
+	}
+	tests := []struct {
+		name   string
+		probes []bool
+	}{
+		{"empty", []bool{}},
+		{"single", []bool{true}},
+		{"partial byte", []bool{true, false, true}},
+		{"full byte", []bool{false, true, false, true, false, true, false, true}},
+		{"two bytes", []bool{true, true, true, true, true, true, true, true, true}},
+		{"multi byte length", many},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeExecProbes(&b, tt.probes)
+			r := reader(&b)
+			got, err := readExecProbes(r)
+			if err != nil {
+				t.Fatalf("readExecProbes() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.probes) {
+				t.Errorf("readExecProbes() = %v, want %v", got, tt.probes)
+			}
+			if _, err := r.ReadByte(); err == nil {
+				t.Errorf("readExecProbes() did not consume all bytes")
+			}
+		})
+	}
+}
+
+func TestReadExecProbesPacking(t *testing.T) {
+	// 10 probes with 0, 2 and 9 hit
+	b := bytes.NewBuffer([]byte{10, 0x05, 0x02})
+	got, err := readExecProbes(reader(b))
+	if err != nil {
+		t.Fatalf("readExecProbes() error = %v", err)
+	}
+	want := []bool{true, false, true, false, false, false, false, false, false, true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readExecProbes() = %v, want %v", got, want)
+	}
+}
+
+func TestReadExecProbesTruncated(t *testing.T) {
+	b := bytes.NewBuffer([]byte{10, 0x05})
+	if _, err := readExecProbes(reader(b)); err == nil {
+		t.Errorf("readExecProbes() of truncated probes succeeded")
+	}
+}
+
+func TestReadExecUTF(t *testing.T) {
+	var b bytes.Buffer
+	writeExecUTF(&b, "org/apache/ratis/server/impl/RaftServerImpl")
+	writeExecUTF(&b, "")
+	r := reader(&b)
+	for _, want := range []string{"org/apache/ratis/server/impl/RaftServerImpl", ""} {
+		got, err := readExecUTF(r)
+		if err != nil {
+			t.Fatalf("readExecUTF() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("readExecUTF() = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestReadExec(t *testing.T) {
+	var b bytes.Buffer
+	writeExecHeader(&b)
+	writeExecSession(&b, "node1")
+	writeExecData(&b, 1, "a/A", []bool{true, false, false})
+	writeExecData(&b, 2, "a/B", []bool{false, true})
+	// A second dump, e.g. of another node appending to the same file
+	writeExecHeader(&b)
+	writeExecSession(&b, "node2")
+	writeExecData(&b, 1, "a/A", []bool{false, false, true})
+
+	data, err := readExec(reader(&b))
+	if err != nil {
+		t.Fatalf("readExec() error = %v", err)
+	}
+	want := map[uint64]*ExecutionData{
+		1: {ID: 1, Name: "a/A", Probes: []bool{true, false, true}},
+		2: {ID: 2, Name: "a/B", Probes: []bool{false, true}},
+	}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("readExec() = %v, want %v", data, want)
+	}
+}
+
+func TestReadExecErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(*bytes.Buffer)
+	}{
+		{"invalid magic number", func(b *bytes.Buffer) {
+			b.Write([]byte{execBlockHeader, 0xCA, 0xFE, 0x10, 0x07})
+		}},
+		{"unsupported version", func(b *bytes.Buffer) {
+			b.Write([]byte{execBlockHeader, 0xC0, 0xC0, 0x10, 0x06})
+		}},
+		{"unknown block", func(b *bytes.Buffer) {
+			writeExecHeader(b)
+			b.WriteByte(0x20)
+		}},
+		{"incompatible probes", func(b *bytes.Buffer) {
+			writeExecHeader(b)
+			writeExecData(b, 1, "a/A", []bool{true})
+			writeExecData(b, 1, "a/A", []bool{true, false})
+		}},
+		{"truncated execution data", func(b *bytes.Buffer) {
+			writeExecHeader(b)
+			writeExecData(b, 1, "a/A", []bool{true})
+			b.Truncate(b.Len() - 1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			tt.write(&b)
+			if _, err := readExec(reader(&b)); err == nil {
+				t.Errorf("readExec() succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestReadExecFile(t *testing.T) {
+	var b bytes.Buffer
+	writeExecHeader(&b)
+	writeExecSession(&b, "node1")
+	writeExecData(&b, 42, "a/A", []bool{false, true})
+	path := filepath.Join(t.TempDir(), "jacoco.exec")
+	if err := os.WriteFile(path, b.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ReadExecFile(path)
+	if err != nil {
+		t.Fatalf("ReadExecFile() error = %v", err)
+	}
+	if class, ok := data[42]; !ok || class.Name != "a/A" || !reflect.DeepEqual(class.Probes, []bool{false, true}) {
+		t.Errorf("ReadExecFile() = %v", data)
+	}
+	if _, err := ReadExecFile(filepath.Join(t.TempDir(), "missing.exec")); err == nil {
+		t.Errorf("ReadExecFile() of a missing file succeeded")
+	}
+}
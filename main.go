@@ -18,26 +18,15 @@ func main() {
 	fuzzerType := ModelFuzz
 	strategy := CodeAndStateCoverage
 
-	// Setup JaCoCo
-	baseWorkingDir := "./output/" + fuzzerType.String()
-	jacocoDestFile := baseWorkingDir + "/jacoco/jacocoRun.exec"
-	jacocoAgent := fmt.Sprintf("-javaagent:./jacocoagent.jar=output=file,destfile=%s,append=true,dumponexit=true", jacocoDestFile)
-	os.Setenv("JAVA_TOOL_OPTIONS", jacocoAgent)
-
 	var wg sync.WaitGroup
 
-	// Parse JaCoCo file
-	javaToolOptions := os.Getenv("JAVA_TOOL_OPTIONS")
-	var jacocoFile string
-	for _, opt := range strings.Split(javaToolOptions, ",") {
-		if strings.HasPrefix(opt, "destfile=") {
-			jacocoFile = strings.TrimPrefix(opt, "destfile=")
-			break
-		}
-	}
-
 	// Configure both fuzzer and cluster
 	var BaseWorkingDir = "./output/" + fuzzerType.String()
+	jacoco := &JacocoAgentConfig{
+		AgentJar:         "./jacocoagent.jar",
+		DestFile:         BaseWorkingDir + "/jacoco/jacocoRun.exec",
+		InstrumentClient: true,
+	}
 	jacocoOutput := BaseWorkingDir + "/jacoco/jacocoOutput.xml"
 	config := FuzzerConfig{
 		maxMutations:      20,
@@ -48,7 +37,7 @@ func main() {
 		NetworkPort:       7074,
 		BaseWorkingDir:    BaseWorkingDir,
 		RatisDataDir:      "./data",
-		jacocoFile:        jacocoFile,
+		jacocoFile:        jacoco.DestFile,
 		jacocoOutput:      jacocoOutput,
 		MutationsPerTrace: 5,
 		SeedPopulation:    20,
@@ -57,6 +46,9 @@ func main() {
 		MaxMessages:       20,
 		ReseedFrequency:   250,
 		RandomSeed:        seed,
+		Generator:         UniformGeneration,
+		PCTDepth:          20,
+		LeaderBias:        0.7,
 
 		ClusterConfig: &ClusterConfig{
 			FuzzerType:          fuzzerType,
@@ -71,6 +63,7 @@ func main() {
 			BaseServicePort:     3330 + ((numNodes + 1) * 100), //(i * (numNodes + 1) * 100),
 			BaseInterceptorPort: 7000 + ((numNodes + 1) * 100), //(i * (numNodes + 1) * 100),
 			LogLevel:            logLevel,
+			Jacoco:              jacoco,
 		},
 		TLCPort: 2023,
 	}
@@ -82,7 +75,7 @@ func main() {
 
 	fuzzer, err := NewFuzzer(config, config.ClusterConfig.FuzzerType, strategy)
 	if err != nil {
-		fmt.Errorf("Could not create fuzzer %e", err)
+		fmt.Printf("Could not create fuzzer: %v\n", err)
 		return
 	}
 
@@ -0,0 +1,115 @@
+package main
+
+import "hash/fnv"
+
+// ModelCoverage tracks coverage metrics derived from the parsed TLC states and
+// the events that were sent to TLC: the distinct values of each variable, how
+// often each action was exercised and which pairs of consecutive actions were
+// exercised.
+//
+// For variables that map nodes to values (functions and sequences) the
+// values of the individual entries are tracked as "var[*]" and, when the
+// entries are themselves collections, their lengths as "Len(var[*])".
+// Values are kept as fingerprints of their canonical representation.
+type ModelCoverage struct {
+	values  map[string]map[uint64]bool
+	maxima  map[string]int
+	actions map[string]int
+	pairs   map[string]bool
+}
+
+func NewModelCoverage() *ModelCoverage {
+	return &ModelCoverage{
+		values:  make(map[string]map[uint64]bool),
+		maxima:  make(map[string]int),
+		actions: make(map[string]int),
+		pairs:   make(map[string]bool),
+	}
+}
+
+// Update records the variable values of the states and the actions of the events
+func (m *ModelCoverage) Update(states []TLCState, events []Event) {
+	for _, s := range states {
+		for name, v := range s.State {
+			m.addValue(name, v)
+			if v.Kind == TLASeq || v.Kind == TLASet {
+				m.addInt("Len("+name+")", v.Len())
+			}
+			if v.Kind != TLAFunction && v.Kind != TLASeq {
+				continue
+			}
+			for _, e := range v.Elems {
+				m.addValue(name+"[*]", e)
+				if e.Kind == TLASeq || e.Kind == TLASet || e.Kind == TLAFunction {
+					m.addInt("Len("+name+"[*])", e.Len())
+				}
+			}
+		}
+	}
+
+	prev := ""
+	for _, e := range events {
+		if e.Reset {
+			continue
+		}
+		m.actions[e.Name] += 1
+		if prev != "" {
+			m.pairs[prev+" -> "+e.Name] = true
+		}
+		prev = e.Name
+	}
+}
+
+func (m *ModelCoverage) addValue(name string, v *TLAValue) {
+	if _, ok := m.values[name]; !ok {
+		m.values[name] = make(map[uint64]bool)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(v.String()))
+	m.values[name][h.Sum64()] = true
+	if v.Kind == TLAInt {
+		m.updateMax(name, v.Int)
+	}
+}
+
+func (m *ModelCoverage) addInt(name string, i int) {
+	m.addValue(name, &TLAValue{Kind: TLAInt, Int: i})
+}
+
+func (m *ModelCoverage) updateMax(name string, i int) {
+	if max, ok := m.maxima[name]; !ok || i > max {
+		m.maxima[name] = i
+	}
+}
+
+// VariableValues returns the number of distinct values seen for each variable
+func (m *ModelCoverage) VariableValues() map[string]int {
+	values := make(map[string]int)
+	for name, seen := range m.values {
+		values[name] = len(seen)
+	}
+	return values
+}
+
+// VariableMaxima returns the largest value seen for each integer valued variable
+func (m *ModelCoverage) VariableMaxima() map[string]int {
+	maxima := make(map[string]int)
+	for name, max := range m.maxima {
+		maxima[name] = max
+	}
+	return maxima
+}
+
+// ActionCounts returns how often each action was exercised
+func (m *ModelCoverage) ActionCounts() map[string]int {
+	counts := make(map[string]int)
+	for name, count := range m.actions {
+		counts[name] = count
+	}
+	return counts
+}
+
+// ActionPairs returns the number of distinct pairs of consecutive actions exercised
+func (m *ModelCoverage) ActionPairs() int {
+	return len(m.pairs)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 )
 
@@ -173,20 +174,492 @@ type combinedMutator struct {
 
 var _ Mutator = &combinedMutator{}
 
+// Mutate applies the mutators in sequence. Mutators that are not applicable to
+// the current trace are skipped, the mutation fails only if none could be applied.
 func (c *combinedMutator) Mutate(trace *Trace, eventTrace *EventTrace) (*Trace, bool) {
 	curTrace := trace.Copy()
+	applied := false
 	for _, m := range c.mutators {
 		nextTrace, ok := m.Mutate(curTrace, eventTrace)
 		if !ok {
-			return nil, false
+			continue
 		}
 		curTrace = nextTrace
+		applied = true
 	}
-	return curTrace, true
+	return curTrace, applied
 }
 
 func CombineMutators(mutators ...Mutator) Mutator {
 	return &combinedMutator{
 		mutators: mutators,
 	}
+}
+
+// WeightedMutator is a named mutator together with the probability of it
+// being picked by the mutator returned from NewWeightedMutator.
+type WeightedMutator struct {
+	Name    string
+	Weight  float64
+	Mutator Mutator
+}
+
+type weightedMutator struct {
+	mutators []WeightedMutator
+	r        *rand.Rand
+}
+
+var _ Mutator = &weightedMutator{}
+
+// NewWeightedMutator returns a mutator that picks a random subset of the given
+// mutators, each one independently with probability equal to its weight, and
+// applies them in order. Mutators that are not applicable are skipped and the
+// names of the applied ones are recorded in the Mutators of the new trace.
+func NewWeightedMutator(random *rand.Rand, mutators ...WeightedMutator) Mutator {
+	return &weightedMutator{
+		mutators: mutators,
+		r:        random,
+	}
+}
+
+func (w *weightedMutator) Mutate(trace *Trace, eventTrace *EventTrace) (*Trace, bool) {
+	picked := make([]WeightedMutator, 0)
+	totalWeight := 0.0
+	for _, m := range w.mutators {
+		totalWeight += m.Weight
+		if w.r.Float64() < m.Weight {
+			picked = append(picked, m)
+		}
+	}
+	if len(picked) == 0 {
+		// Fall back to a single mutator picked proportionally to the weights
+		if totalWeight <= 0 {
+			return nil, false
+		}
+		target := w.r.Float64() * totalWeight
+		for _, m := range w.mutators {
+			target -= m.Weight
+			if target < 0 {
+				picked = append(picked, m)
+				break
+			}
+		}
+	}
+
+	curTrace := trace
+	applied := make([]string, 0, len(picked))
+	for _, m := range picked {
+		nextTrace, ok := m.Mutator.Mutate(curTrace, eventTrace)
+		if !ok {
+			continue
+		}
+		curTrace = nextTrace
+		applied = append(applied, m.Name)
+	}
+	if len(applied) == 0 {
+		return nil, false
+	}
+	newTrace := curTrace.Copy()
+	newTrace.Mutators = applied
+	return newTrace, true
+}
+
+type MutatorSchedule int
+
+const (
+	WeightedSchedule MutatorSchedule = 0
+	UCBSchedule      MutatorSchedule = 1
+	ThompsonSchedule MutatorSchedule = 2
+)
+
+func (ms MutatorSchedule) String() string {
+	switch ms {
+	case WeightedSchedule:
+		return "weighted"
+	case UCBSchedule:
+		return "ucb"
+	case ThompsonSchedule:
+		return "thompson"
+	default:
+		return fmt.Sprintf("%d", int(ms))
+	}
+}
+
+// adaptiveMutator picks a single mutator per mutation, treating the mutators
+// as arms of a bandit. The reward of an arm is whether the executed mutants of
+// the mutator discovered new states, transitions or lines, as recorded in the
+// shared mutator stats.
+type adaptiveMutator struct {
+	schedule MutatorSchedule
+	mutators []WeightedMutator
+	stats    map[string]*MutatorStat
+	r        *rand.Rand
+}
+
+var _ Mutator = &adaptiveMutator{}
+
+// NewAdaptiveMutator returns a mutator that selects among the given mutators
+// with UCB1 or Thompson sampling based on the success statistics in stats. The
+// stats are expected to be updated by the caller after executing each mutant.
+func NewAdaptiveMutator(schedule MutatorSchedule, stats map[string]*MutatorStat, random *rand.Rand, mutators ...WeightedMutator) Mutator {
+	for _, m := range mutators {
+		if _, ok := stats[m.Name]; !ok {
+			stats[m.Name] = &MutatorStat{}
+		}
+	}
+	return &adaptiveMutator{
+		schedule: schedule,
+		mutators: mutators,
+		stats:    stats,
+		r:        random,
+	}
+}
+
+func (a *adaptiveMutator) Mutate(trace *Trace, eventTrace *EventTrace) (*Trace, bool) {
+	scores := make([]float64, len(a.mutators))
+	total := 0
+	for _, m := range a.mutators {
+		total += a.stats[m.Name].Executed
+	}
+	for i, m := range a.mutators {
+		scores[i] = a.score(a.stats[m.Name], total)
+	}
+
+	// Try the mutators in order of decreasing score until one is applicable.
+	// Ties, such as between mutators that have not been executed yet, are
+	// broken at random.
+	tried := make(map[int]bool)
+	for len(tried) < len(a.mutators) {
+		best := -1
+		for _, i := range a.r.Perm(len(a.mutators)) {
+			if tried[i] || a.mutators[i].Weight <= 0 {
+				continue
+			}
+			if best == -1 || scores[i] > scores[best] {
+				best = i
+			}
+		}
+		if best == -1 {
+			break
+		}
+		tried[best] = true
+
+		if newTrace, ok := a.mutators[best].Mutator.Mutate(trace, eventTrace); ok {
+			newTrace = newTrace.Copy()
+			newTrace.Mutators = []string{a.mutators[best].Name}
+			return newTrace, true
+		}
+	}
+	return nil, false
+}
+
+func (a *adaptiveMutator) score(stat *MutatorStat, total int) float64 {
+	switch a.schedule {
+	case ThompsonSchedule:
+		failures := stat.Executed - stat.Successes
+		return sampleBeta(float64(1+stat.Successes), float64(1+failures), a.r)
+	default:
+		if stat.Executed == 0 {
+			return math.Inf(1)
+		}
+		mean := float64(stat.Successes) / float64(stat.Executed)
+		return mean + math.Sqrt(2*math.Log(float64(total))/float64(stat.Executed))
+	}
+}
+
+// SpliceMutator crosses the trace over with a partner drawn from the corpus.
+// The new trace keeps the choices of the original trace up to a random cut
+// step and takes the choices of the partner from the cut step onwards.
+type SpliceMutator struct {
+	corpus func() []*Trace
+	r      *rand.Rand
+}
+
+var _ Mutator = &SpliceMutator{}
+
+func NewSpliceMutator(corpus func() []*Trace, random *rand.Rand) *SpliceMutator {
+	return &SpliceMutator{
+		corpus: corpus,
+		r:      random,
+	}
+}
+
+func (s *SpliceMutator) Mutate(trace *Trace, _ *EventTrace) (*Trace, bool) {
+	partner, ok := pickPartner(s.corpus(), trace, s.r)
+	if !ok {
+		return nil, false
+	}
+
+	horizon := trace.Steps()
+	if partnerHorizon := partner.Steps(); partnerHorizon < horizon {
+		horizon = partnerHorizon
+	}
+	if horizon < 2 {
+		return nil, false
+	}
+	cut := 1 + s.r.Intn(horizon-1)
+
+	// The suffix comes from the partner and so does the horizon
+	newTrace := NewTrace()
+	newTrace.Horizon = partner.Steps()
+	newTrace.Params = trace.Params
+	for _, ch := range trace.Choices {
+		if ch.Step < cut {
+			newTrace.Add(ch)
+		}
+	}
+	for _, ch := range partner.Choices {
+		if ch.Step >= cut {
+			newTrace.Add(ch)
+		}
+	}
+	return newTrace, true
+}
+
+// CrashSpliceMutator crosses the trace over with a partner drawn from the
+// corpus by keeping the message deliveries and client requests of the trace
+// and replacing its crash points with the ones of the partner.
+type CrashSpliceMutator struct {
+	corpus func() []*Trace
+	r      *rand.Rand
+}
+
+var _ Mutator = &CrashSpliceMutator{}
+
+func NewCrashSpliceMutator(corpus func() []*Trace, random *rand.Rand) *CrashSpliceMutator {
+	return &CrashSpliceMutator{
+		corpus: corpus,
+		r:      random,
+	}
+}
+
+func (s *CrashSpliceMutator) Mutate(trace *Trace, _ *EventTrace) (*Trace, bool) {
+	partner, ok := pickPartner(s.corpus(), trace, s.r)
+	if !ok {
+		return nil, false
+	}
+
+	horizon := trace.Steps()
+	newTrace := NewTrace()
+	newTrace.Horizon = trace.Horizon
+	newTrace.Params = trace.Params
+	for _, ch := range trace.Choices {
+		if ch.Type != "Crash" {
+			newTrace.Add(ch)
+		}
+	}
+	numCrashes := 0
+	for _, ch := range partner.Choices {
+		if ch.Type == "Crash" && ch.Step < horizon {
+			newTrace.Add(ch)
+			numCrashes++
+		}
+	}
+	if numCrashes == 0 {
+		return nil, false
+	}
+	return newTrace, true
+}
+
+// pickPartner returns a random trace from the corpus that is not the trace itself.
+func pickPartner(corpus []*Trace, trace *Trace, r *rand.Rand) (*Trace, bool) {
+	candidates := make([]*Trace, 0, len(corpus))
+	for _, t := range corpus {
+		if t != trace {
+			candidates = append(candidates, t)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, false
+	}
+	return candidates[r.Intn(len(candidates))], true
+}
+
+// LeaderCrashMutator places a crash on a node right after it was observed
+// becoming leader in the event trace of the previous execution.
+type LeaderCrashMutator struct {
+	r *rand.Rand
+}
+
+var _ Mutator = &LeaderCrashMutator{}
+
+func NewLeaderCrashMutator(random *rand.Rand) *LeaderCrashMutator {
+	return &LeaderCrashMutator{
+		r: random,
+	}
+}
+
+func (l *LeaderCrashMutator) Mutate(trace *Trace, eventTrace *EventTrace) (*Trace, bool) {
+	horizon := trace.Steps()
+	leaderEvents := make([]Event, 0)
+	for _, e := range eventTrace.Events {
+		if e.Name == "BecomeLeader" && e.Node != "" && e.Step+1 < horizon {
+			leaderEvents = append(leaderEvents, e)
+		}
+	}
+	if len(leaderEvents) == 0 {
+		return nil, false
+	}
+	e := leaderEvents[l.r.Intn(len(leaderEvents))]
+
+	crash := Choice{
+		Type: "Crash",
+		Node: e.Node,
+		Step: e.Step + 1,
+	}
+
+	// Move one of the existing crashes so that the number of crashes stays the same
+	crashChoices := make([]int, 0)
+	for i, ch := range trace.Choices {
+		if ch.Type == "Crash" {
+			if ch.Step == crash.Step && ch.Node == crash.Node {
+				return nil, false
+			}
+			crashChoices = append(crashChoices, i)
+		}
+	}
+
+	newTrace := trace.Copy()
+	if len(crashChoices) == 0 {
+		newTrace.Add(crash)
+	} else {
+		newTrace.Choices[crashChoices[l.r.Intn(len(crashChoices))]] = crash
+	}
+	return newTrace, true
+}
+
+// VoteStarvationMutator stops message delivery for a window of steps right
+// after a vote request was delivered in the previous execution.
+type VoteStarvationMutator struct {
+	Window int
+	r      *rand.Rand
+}
+
+var _ Mutator = &VoteStarvationMutator{}
+
+func NewVoteStarvationMutator(window int, random *rand.Rand) *VoteStarvationMutator {
+	return &VoteStarvationMutator{
+		Window: window,
+		r:      random,
+	}
+}
+
+func (v *VoteStarvationMutator) Mutate(trace *Trace, eventTrace *EventTrace) (*Trace, bool) {
+	voteSteps := make([]int, 0)
+	for _, e := range eventTrace.Events {
+		if e.Name != "DeliverMessage" {
+			continue
+		}
+		if t, ok := e.Params["type"].(string); ok && t == "MsgVote" {
+			voteSteps = append(voteSteps, e.Step)
+		}
+	}
+	if len(voteSteps) == 0 {
+		return nil, false
+	}
+	step := voteSteps[v.r.Intn(len(voteSteps))]
+
+	newTrace := trace.Copy()
+	starved := 0
+	for i, ch := range newTrace.Choices {
+		if ch.Type == "Node" && ch.Step > step && ch.Step <= step+v.Window && ch.MaxMessages > 0 {
+			newCh := ch.Copy()
+			newCh.MaxMessages = 0
+			newTrace.Choices[i] = newCh
+			starved++
+		}
+	}
+	if starved == 0 {
+		return nil, false
+	}
+	return newTrace, true
+}
+
+// ExtendMutator appends a random number of fresh random delivery steps to the
+// end of the trace, up to a maximum horizon. The steps stay within the node and
+// message bounds of the trace's params, or of the mutator for traces without.
+type ExtendMutator struct {
+	MaxSteps    int
+	MaxHorizon  int
+	NumNodes    int
+	MaxMessages int
+	r           *rand.Rand
+}
+
+var _ Mutator = &ExtendMutator{}
+
+func NewExtendMutator(maxSteps, maxHorizon, numNodes, maxMessages int, random *rand.Rand) *ExtendMutator {
+	return &ExtendMutator{
+		MaxSteps:    maxSteps,
+		MaxHorizon:  maxHorizon,
+		NumNodes:    numNodes,
+		MaxMessages: maxMessages,
+		r:           random,
+	}
+}
+
+func (e *ExtendMutator) Mutate(trace *Trace, _ *EventTrace) (*Trace, bool) {
+	horizon := trace.Steps()
+	steps := e.MaxSteps
+	if horizon+steps > e.MaxHorizon {
+		steps = e.MaxHorizon - horizon
+	}
+	if steps <= 0 {
+		return nil, false
+	}
+	numNodes, maxMessages := e.NumNodes, e.MaxMessages
+	if trace.Params != nil {
+		numNodes, maxMessages = trace.Params.NumNodes, trace.Params.MaxMessages
+	}
+	if numNodes <= 0 || maxMessages <= 0 {
+		return nil, false
+	}
+	steps = 1 + e.r.Intn(steps)
+
+	newTrace := trace.Copy()
+	for i := horizon; i < horizon+steps; i++ {
+		newTrace.Add(deliveryChoice(i, e.r.Intn(numNodes)+1, e.r.Intn(numNodes)+1, maxMessages, e.r))
+	}
+	newTrace.Horizon = horizon + steps
+	return newTrace, true
+}
+
+// TruncateMutator drops a random number of steps from the end of the trace,
+// down to a minimum horizon.
+type TruncateMutator struct {
+	MaxSteps   int
+	MinHorizon int
+	r          *rand.Rand
+}
+
+var _ Mutator = &TruncateMutator{}
+
+func NewTruncateMutator(maxSteps, minHorizon int, random *rand.Rand) *TruncateMutator {
+	return &TruncateMutator{
+		MaxSteps:   maxSteps,
+		MinHorizon: minHorizon,
+		r:          random,
+	}
+}
+
+func (t *TruncateMutator) Mutate(trace *Trace, _ *EventTrace) (*Trace, bool) {
+	horizon := trace.Steps()
+	steps := t.MaxSteps
+	if horizon-steps < t.MinHorizon {
+		steps = horizon - t.MinHorizon
+	}
+	if steps <= 0 {
+		return nil, false
+	}
+	newHorizon := horizon - (1 + t.r.Intn(steps))
+
+	newTrace := NewTrace()
+	newTrace.Horizon = newHorizon
+	newTrace.Params = trace.Params
+	for _, ch := range trace.Choices {
+		if ch.Step < newHorizon {
+			newTrace.Add(ch)
+		}
+	}
+	return newTrace, true
 }
\ No newline at end of file
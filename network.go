@@ -30,6 +30,7 @@ type Network struct {
 	requestMap         map[string]int
 	requestCounter     int
 	nodeType           NodeType
+	step               int
 }
 
 func (n *Network) AddClientRequestEvent(requestCount int) {
@@ -249,6 +250,7 @@ func (n *Network) handleEvent(c *gin.Context) {
 	}
 
 	n.lock.Lock()
+	e.Step = n.step
 	n.Events.Add(e)
 	n.lock.Unlock()
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
@@ -399,6 +401,14 @@ func (n *Network) Reset() {
 	n.leader = ""
 	n.requestMap = make(map[string]int)
 	n.requestCounter = 0
+	n.step = 0
+}
+
+// SetStep sets the schedule step that subsequently recorded events are tagged with.
+func (n *Network) SetStep(step int) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	n.step = step
 }
 
 func (n *Network) GetEventTrace() *EventTrace {
@@ -411,6 +421,7 @@ func (n *Network) GetEventTrace() *EventTrace {
 func (n *Network) AddEvent(e Event) {
 	n.lock.Lock()
 	defer n.lock.Unlock()
+	e.Step = n.step
 	n.Events.Add(e)
 }
 
@@ -498,6 +509,7 @@ func (n *Network) Schedule(from, to string, maxMessages int) {
 			Params: n.getMessageEventParams(m),
 		}
 		n.lock.Lock()
+		receiveEvent.Step = n.step
 		n.Events.Add(receiveEvent)
 		n.lock.Unlock()
 	}
@@ -53,6 +53,7 @@ func (x *RatisNode) Create() {
 
 	x.process = exec.Command("java", serverArgs...)
 	x.process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	x.process.Env = javaEnv(x.config.JavaToolOptions)
 
 	if x.stdout == nil {
 		x.stdout = new(bytes.Buffer)
@@ -79,30 +80,34 @@ func (x *RatisNode) Cleanup() {
 
 func (x *RatisNode) Stop() error {
 	x.logger.Debug("Stopping node...")
-	if x.process == nil {
+	if x.process == nil || x.process.Process == nil {
 		return errors.New("ratis server not started")
 	}
-	// done := make(chan error, 1)
-	// go func() {
-	// 	err := x.process.Wait()
-	// 	done <- err
-	// }()
-
-	// var err error = nil
-	// select {
-	// case <- time.After(50 * time.Millisecond):
-	// 	err = x.process.Process.Kill()
-	// case err = <- done:
-	// }
 
-	var err error
-	if x.process.Process != nil {
-		err = syscall.Kill(-x.process.Process.Pid, syscall.SIGKILL)
+	// SIGTERM lets the JaCoCo agent dump its execution data on exit
+	err := syscall.Kill(-x.process.Process.Pid, syscall.SIGTERM)
+	if err != nil {
+		x.logger.Debug("SIGTERM failed, trying SIGKILL")
+		_ = syscall.Kill(-x.process.Process.Pid, syscall.SIGKILL)
+		x.process = nil
+		return err
 	}
 
-	x.process = nil
+	done := make(chan error, 1)
+	go func() {
+		done <- x.process.Wait()
+	}()
 
-	return err
+	select {
+	case err := <-done:
+		x.process = nil
+		return err
+	case <-time.After(20 * time.Second):
+		x.logger.Debug("Process still running, sending SIGKILL")
+		_ = syscall.Kill(-x.process.Process.Pid, syscall.SIGKILL)
+		x.process = nil
+		return errors.New("process did not terminate in time")
+	}
 }
 
 func (x *RatisNode) GetLogs() (string, string) {
@@ -119,14 +124,16 @@ type RatisClient struct {
 	logger           *Logger
 	RatisLog4jConfig string
 	PeerAddresses    string
+	JavaToolOptions  string
 }
 
-func NewRatisClient(clientBinary, peerAddresses, log4jConfig string, logger *Logger) *RatisClient {
+func NewRatisClient(clientBinary, peerAddresses, log4jConfig, javaToolOptions string, logger *Logger) *RatisClient {
 	return &RatisClient{
 		ClientBinary:     clientBinary,
 		logger:           logger,
 		RatisLog4jConfig: log4jConfig,
 		PeerAddresses:    peerAddresses,
+		JavaToolOptions:  javaToolOptions,
 	}
 }
 
@@ -145,6 +152,7 @@ func (c *RatisClient) SendRequest() {
 	// }
 
 	process := exec.Command("java", clientArgs...)
+	process.Env = javaEnv(c.JavaToolOptions)
 
 	// cmdDone := make(chan error, 1)
 	process.Start()
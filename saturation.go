@@ -0,0 +1,46 @@
+package main
+
+// Chao1 estimates the total number of states, including the ones not
+// discovered yet, from the number of traces each discovered state was
+// reached in. It uses the bias corrected form S + f1(f1-1) / 2(f2+1) where
+// f1 and f2 are the numbers of states reached in exactly one and two traces.
+func Chao1(frequencies map[int64]int) float64 {
+	f1, f2 := 0, 0
+	for _, n := range frequencies {
+		switch n {
+		case 1:
+			f1++
+		case 2:
+			f2++
+		}
+	}
+	return float64(len(frequencies)) + float64(f1*(f1-1))/float64(2*(f2+1))
+}
+
+// PlateauConfig configures when a campaign has saturated and can be stopped early
+type PlateauConfig struct {
+	// Number of iterations over which the discovery rate is measured
+	Window int
+	// Stop when at most this many new states per iteration are discovered over the window
+	DiscoveryRate float64
+	// and the estimated fraction of undiscovered states is at most this
+	Remaining float64
+}
+
+// Reached reports whether state discovery plateaued given the number of
+// states after every iteration and the estimated total number of states
+func (p *PlateauConfig) Reached(coverages []int, estimate float64) bool {
+	if p.Window <= 0 || len(coverages) <= p.Window {
+		return false
+	}
+	last := coverages[len(coverages)-1]
+	rate := float64(last-coverages[len(coverages)-1-p.Window]) / float64(p.Window)
+	if rate > p.DiscoveryRate {
+		return false
+	}
+	remaining := 0.0
+	if estimate > 0 {
+		remaining = (estimate - float64(last)) / estimate
+	}
+	return remaining <= p.Remaining
+}
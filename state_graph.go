@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// StateGraph is the graph of TLC states reached by the fuzzer. Nodes are
+// state keys and edges the observed transitions between them, labelled with
+// the events that caused them and the iteration they were first observed in.
+type StateGraph struct {
+	nodes map[int64]string
+	edges map[stateEdge]*StateEdge
+}
+
+type stateEdge struct {
+	From int64
+	To   int64
+}
+
+type StateEdge struct {
+	From           int64
+	To             int64
+	Events         map[string]bool
+	FirstIteration int
+}
+
+func NewStateGraph() *StateGraph {
+	return &StateGraph{
+		nodes: make(map[int64]string),
+		edges: make(map[stateEdge]*StateEdge),
+	}
+}
+
+// AddState adds a node for the state unless one with the same key exists
+func (g *StateGraph) AddState(s TLCState) {
+	if _, ok := g.nodes[s.Key]; !ok {
+		g.nodes[s.Key] = formatState(s)
+	}
+}
+
+// AddTransition adds the edge between the states or the event to an existing edge
+func (g *StateGraph) AddTransition(from, to int64, event string, iteration int) {
+	key := stateEdge{From: from, To: to}
+	edge, ok := g.edges[key]
+	if !ok {
+		edge = &StateEdge{
+			From:           from,
+			To:             to,
+			Events:         make(map[string]bool),
+			FirstIteration: iteration,
+		}
+		g.edges[key] = edge
+	}
+	if event != "" {
+		edge.Events[event] = true
+	}
+}
+
+// formatState prints the parsed variables of the state one per line, sorted
+// by name, and falls back to the raw TLC representation
+func formatState(s TLCState) string {
+	if s.State == nil {
+		return strings.TrimSpace(s.Repr)
+	}
+	lines := make([]string, 0, len(s.State))
+	for name, v := range s.State {
+		lines = append(lines, name+" = "+v.String())
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func (g *StateGraph) sortedNodes() []int64 {
+	keys := make([]int64, 0, len(g.nodes))
+	for k := range g.nodes {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func (g *StateGraph) sortedEdges() []*StateEdge {
+	edges := make([]*StateEdge, 0, len(g.edges))
+	for _, e := range g.edges {
+		edges = append(edges, e)
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+	return edges
+}
+
+func (e *StateEdge) eventNames() string {
+	names := make([]string, 0, len(e.Events))
+	for name := range e.Events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return "\"" + strings.ReplaceAll(s, "\n", "\\l") + "\""
+}
+
+// WriteDOT writes the graph in the Graphviz DOT format
+func (g *StateGraph) WriteDOT(w io.Writer) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph states {")
+	fmt.Fprintln(b, "\tnode [shape=box];")
+	for _, k := range g.sortedNodes() {
+		fmt.Fprintf(b, "\t\"%d\" [label=%s];\n", k, dotQuote(g.nodes[k]+"\n"))
+	}
+	for _, e := range g.sortedEdges() {
+		fmt.Fprintf(b, "\t\"%d\" -> \"%d\" [label=%s, first_iteration=%d];\n", e.From, e.To, dotQuote(e.eventNames()), e.FirstIteration)
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
+
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// WriteGraphML writes the graph in the GraphML format
+func (g *StateGraph) WriteGraphML(w io.Writer) error {
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "state", For: "node", Name: "state", Type: "string"},
+			{ID: "events", For: "edge", Name: "events", Type: "string"},
+			{ID: "first_iteration", For: "edge", Name: "first_iteration", Type: "int"},
+		},
+		Graph: graphMLGraph{
+			ID:          "states",
+			EdgeDefault: "directed",
+			Nodes:       make([]graphMLNode, 0, len(g.nodes)),
+			Edges:       make([]graphMLEdge, 0, len(g.edges)),
+		},
+	}
+	for _, k := range g.sortedNodes() {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{
+			ID:   fmt.Sprint(k),
+			Data: []graphMLData{{Key: "state", Value: g.nodes[k]}},
+		})
+	}
+	for _, e := range g.sortedEdges() {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: fmt.Sprint(e.From),
+			Target: fmt.Sprint(e.To),
+			Data: []graphMLData{
+				{Key: "events", Value: e.eventNames()},
+				{Key: "first_iteration", Value: fmt.Sprint(e.FirstIteration)},
+			},
+		})
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "\t")
+	return enc.Encode(doc)
+}
+
+// Save writes the graph to path.dot and path.graphml
+func (g *StateGraph) Save(path string) error {
+	for ext, write := range map[string]func(io.Writer) error{
+		".dot":     g.WriteDOT,
+		".graphml": g.WriteGraphML,
+	} {
+		file, err := os.Create(path + ext)
+		if err != nil {
+			return err
+		}
+		err = write(file)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("error writing %s: %s", path+ext, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Signals that strategy formulas can refer to. Novelty is the number of new
+// states, or the number of new event traces for the trace fuzzer. Oracles is
+// the number of target predicates and code targets the trace reached.
+var strategySignals = []string{"states", "transitions", "lines", "branches", "traces", "novelty", "oracles"}
+
+// Strategy scores the coverage feedback of a trace as a weighted sum of
+// signals. Traces with a positive score are mutated, with the number of
+// mutants growing with the score.
+type Strategy struct {
+	Name    string
+	Formula string
+	Weights map[string]float64
+}
+
+// builtinStrategies are the formulas of the predefined mutation types
+var builtinStrategies = map[mutationType]string{
+	StateCoverage:        "novelty",
+	TransitionCoverage:   "transitions",
+	CodeAndStateCoverage: "lines + novelty",
+}
+
+// ParseStrategy parses a formula such as "2*transitions + lines" into a strategy.
+// A formula is a sum of terms, each a product of numbers and at most one signal.
+func ParseStrategy(name, formula string) (*Strategy, error) {
+	s := &Strategy{
+		Name:    name,
+		Formula: formula,
+		Weights: make(map[string]float64),
+	}
+	expr := strings.ReplaceAll(formula, " ", "")
+	for expr != "" {
+		sign := 1.0
+		if expr[0] == '+' || expr[0] == '-' {
+			if expr[0] == '-' {
+				sign = -1.0
+			}
+			expr = expr[1:]
+		}
+		weight := 1.0
+		signal := ""
+		for {
+			if number := strategyNumber.FindString(expr); number != "" {
+				v, err := strconv.ParseFloat(number, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number %q in strategy %s", number, name)
+				}
+				weight *= v
+				expr = expr[len(number):]
+			} else if ident := strategyIdent.FindString(expr); ident != "" {
+				if signal != "" || !isSignal(ident) {
+					return nil, fmt.Errorf("invalid signal %q in strategy %s", ident, name)
+				}
+				signal = ident
+				expr = expr[len(ident):]
+			} else if expr == "" {
+				return nil, fmt.Errorf("unexpected end of strategy %s", name)
+			} else {
+				return nil, fmt.Errorf("unexpected %q in strategy %s", expr, name)
+			}
+			if !strings.HasPrefix(expr, "*") {
+				break
+			}
+			expr = expr[1:]
+		}
+		if signal == "" {
+			return nil, fmt.Errorf("term without signal in strategy %s", name)
+		}
+		if expr != "" && expr[0] != '+' && expr[0] != '-' {
+			return nil, fmt.Errorf("unexpected %q in strategy %s", expr, name)
+		}
+		s.Weights[signal] += sign * weight
+	}
+	if len(s.Weights) == 0 {
+		return nil, fmt.Errorf("empty strategy %s", name)
+	}
+	return s, nil
+}
+
+var (
+	strategyNumber = regexp.MustCompile(`^([0-9]+\.?[0-9]*|\.[0-9]+)([eE][+-]?[0-9]+)?`)
+	strategyIdent  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*`)
+)
+
+func isSignal(name string) bool {
+	for _, s := range strategySignals {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Score returns the weighted sum of the signals
+func (s *Strategy) Score(signals map[string]float64) float64 {
+	score := 0.0
+	for signal, weight := range s.Weights {
+		score += weight * signals[signal]
+	}
+	return score
+}
+
+// NewStrategyRegistry returns the built-in strategies together with the
+// custom ones, given as formulas keyed by strategy name.
+func NewStrategyRegistry(custom map[string]string) (map[string]*Strategy, error) {
+	registry := make(map[string]*Strategy)
+	for mt, formula := range builtinStrategies {
+		s, err := ParseStrategy(mt.String(), formula)
+		if err != nil {
+			return nil, err
+		}
+		registry[s.Name] = s
+	}
+
+	names := make([]string, 0, len(custom))
+	for name := range custom {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s, err := ParseStrategy(name, custom[name])
+		if err != nil {
+			return nil, err
+		}
+		registry[name] = s
+	}
+	return registry, nil
+}
+
+// BanditStrategy is the name of the meta-strategy that picks among other strategies
+const BanditStrategy = "bandit"
+
+// StrategyBandit decides which strategy scores the traces of each iteration.
+// Every strategy is an arm, rewarded whenever a trace mutated under it
+// discovers anything new. Arms are selected with UCB1 over the rewards of a
+// sliding window, so that the choice follows recent discovery rates.
+type StrategyBandit struct {
+	arms    []*Strategy
+	window  int
+	rewards map[string][]float64
+}
+
+func NewStrategyBandit(arms []*Strategy, window int) *StrategyBandit {
+	return &StrategyBandit{
+		arms:    arms,
+		window:  window,
+		rewards: make(map[string][]float64),
+	}
+}
+
+// Select returns the strategy to use for the next iteration. The exploration
+// term counts only the rewards within the windows, like the means.
+func (b *StrategyBandit) Select() *Strategy {
+	total := 0
+	for _, arm := range b.arms {
+		total += len(b.rewards[arm.Name])
+	}
+	var best *Strategy
+	bestScore := math.Inf(-1)
+	for _, arm := range b.arms {
+		rewards := b.rewards[arm.Name]
+		if len(rewards) == 0 {
+			return arm
+		}
+		mean := 0.0
+		for _, r := range rewards {
+			mean += r
+		}
+		mean /= float64(len(rewards))
+		score := mean + math.Sqrt(2*math.Log(float64(total))/float64(len(rewards)))
+		if score > bestScore {
+			best = arm
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// Update records the reward of a trace mutated under the named strategy
+func (b *StrategyBandit) Update(name string, reward float64) {
+	rewards := append(b.rewards[name], reward)
+	if len(rewards) > b.window {
+		rewards = rewards[len(rewards)-b.window:]
+	}
+	b.rewards[name] = rewards
+}
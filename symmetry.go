@@ -0,0 +1,159 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symmetry describes how node identities appear in TLC states, so that states
+// differing only by a renaming of the nodes can be identified. Nodes are the
+// node identifiers as printed by TLC. NodeVariables are functions over the
+// nodes. Their keys are renamed, including those of nested functions such as
+// matchIndex, and when TLC prints them as sequences their elements are
+// permuted. NodeValueVariables hold node identifiers as values, for example
+// votedFor, and NodeFields are the record fields holding node identifiers, for
+// example msource and mdest of messages. Model values used as node
+// identifiers are renamed wherever they appear.
+type Symmetry struct {
+	Nodes              []string
+	NodeVariables      []string
+	NodeValueVariables []string
+	NodeFields         []string
+}
+
+// Key returns the fingerprint of the canonical representative of the state
+// under all permutations of the nodes.
+func (s *Symmetry) Key(state map[string]*TLAValue) int64 {
+	names := make([]string, 0, len(state))
+	for name := range state {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonical := ""
+	for _, perm := range permutations(len(s.Nodes)) {
+		rename := make(map[string]string)
+		for i, j := range perm {
+			rename[s.Nodes[i]] = s.Nodes[j]
+		}
+		parts := make([]string, len(names))
+		for i, name := range names {
+			parts[i] = name + "=" + s.permuteVariable(name, state[name], perm, rename).String()
+		}
+		repr := strings.Join(parts, ";")
+		if canonical == "" || repr < canonical {
+			canonical = repr
+		}
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(canonical))
+	return int64(h.Sum64())
+}
+
+func (s *Symmetry) permuteVariable(name string, value *TLAValue, perm []int, rename map[string]string) *TLAValue {
+	renameValues := contains(s.NodeValueVariables, name)
+	if contains(s.NodeVariables, name) {
+		return s.permuteNodeIndexed(value, perm, rename, renameValues)
+	}
+	return s.renameValue(value, rename, renameValues, false)
+}
+
+// permuteNodeIndexed permutes the elements of the sequences with one element
+// per node and renames the keys of the functions in a node-indexed value, at
+// every level of nesting
+func (s *Symmetry) permuteNodeIndexed(value *TLAValue, perm []int, rename map[string]string, renameValues bool) *TLAValue {
+	if value == nil {
+		return nil
+	}
+	switch {
+	case value.Kind == TLASeq && len(value.Elems) == len(perm):
+		permuted := &TLAValue{Kind: TLASeq, Elems: make([]*TLAValue, len(value.Elems))}
+		for i, e := range value.Elems {
+			permuted.Elems[perm[i]] = s.permuteNodeIndexed(e, perm, rename, renameValues)
+		}
+		return permuted
+	case value.Kind == TLAFunction:
+		renamed := &TLAValue{Kind: TLAFunction, Keys: make([]*TLAValue, len(value.Keys)), Elems: make([]*TLAValue, len(value.Elems))}
+		for i, k := range value.Keys {
+			renamed.Keys[i] = s.renameValue(k, rename, true, false)
+			renamed.Elems[i] = s.permuteNodeIndexed(value.Elems[i], perm, rename, renameValues)
+		}
+		return renamed
+	}
+	return s.renameValue(value, rename, renameValues, true)
+}
+
+// renameValue renames the node identifiers in a value. Atoms are renamed if
+// renameAtoms is set and the keys of functions if renameKeys is set, model
+// values always.
+func (s *Symmetry) renameValue(value *TLAValue, rename map[string]string, renameAtoms bool, renameKeys bool) *TLAValue {
+	if value == nil {
+		return nil
+	}
+	switch value.Kind {
+	case TLAFunction:
+		renamed := &TLAValue{Kind: TLAFunction, Keys: make([]*TLAValue, len(value.Keys)), Elems: make([]*TLAValue, len(value.Elems))}
+		for i, k := range value.Keys {
+			renamed.Keys[i] = s.renameValue(k, rename, renameKeys, false)
+			renamed.Elems[i] = s.renameValue(value.Elems[i], rename, renameAtoms, renameKeys)
+		}
+		return renamed
+	case TLARecord:
+		renamed := &TLAValue{Kind: TLARecord, Fields: value.Fields, Elems: make([]*TLAValue, len(value.Elems))}
+		for i, f := range value.Fields {
+			renamed.Elems[i] = s.renameValue(value.Elems[i], rename, renameAtoms || contains(s.NodeFields, f), false)
+		}
+		return renamed
+	case TLASeq, TLASet:
+		renamed := &TLAValue{Kind: value.Kind, Elems: make([]*TLAValue, len(value.Elems))}
+		for i, e := range value.Elems {
+			renamed.Elems[i] = s.renameValue(e, rename, renameAtoms, false)
+		}
+		return renamed
+	case TLAModelValue:
+		renameAtoms = true
+	}
+
+	if to, ok := rename[value.Text()]; ok && renameAtoms {
+		renamed := *value
+		if value.Kind == TLAInt {
+			if n, err := strconv.Atoi(to); err == nil {
+				renamed.Int = n
+			}
+		} else {
+			renamed.Str = to
+		}
+		return &renamed
+	}
+	return value
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// permutations returns all permutations of 0..n-1
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	result := make([][]int, 0)
+	for _, p := range permutations(n - 1) {
+		for i := 0; i <= len(p); i++ {
+			perm := make([]int, 0, n)
+			perm = append(perm, p[:i]...)
+			perm = append(perm, n-1)
+			perm = append(perm, p[i:]...)
+			result = append(result, perm)
+		}
+	}
+	return result
+}
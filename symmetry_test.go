@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestSymmetryKeyNestedSequences(t *testing.T) {
+	symmetry := &Symmetry{
+		Nodes:              []string{"1", "2", "3"},
+		NodeVariables:      []string{"currentTerm", "matchIndex", "votedFor"},
+		NodeValueVariables: []string{"votedFor"},
+	}
+	key := func(repr string) int64 {
+		state, err := ParseTLCState(repr)
+		if err != nil {
+			t.Fatalf("ParseTLCState() error = %v", err)
+		}
+		return symmetry.Key(state)
+	}
+
+	// Node 1 leads and has replicated to node 2
+	state := key("/\\ currentTerm = <<2, 2, 1>>\n" +
+		"/\\ matchIndex = <<<<0, 1, 0>>, <<0, 0, 0>>, <<0, 0, 0>>>>\n" +
+		"/\\ votedFor = <<1, 1, 0>>")
+	// The same state with nodes 1 and 2 swapped
+	swapped := key("/\\ currentTerm = <<2, 2, 1>>\n" +
+		"/\\ matchIndex = <<<<0, 0, 0>>, <<1, 0, 0>>, <<0, 0, 0>>>>\n" +
+		"/\\ votedFor = <<2, 2, 0>>")
+	if state != swapped {
+		t.Errorf("Key() differs for states symmetric under swapping nodes 1 and 2")
+	}
+
+	// Node 2 has replicated to itself, which no renaming of the nodes turns
+	// into the first state
+	different := key("/\\ currentTerm = <<2, 2, 1>>\n" +
+		"/\\ matchIndex = <<<<0, 0, 0>>, <<0, 1, 0>>, <<0, 0, 0>>>>\n" +
+		"/\\ votedFor = <<1, 1, 0>>")
+	if state == different {
+		t.Errorf("Key() equal for states that are not symmetric")
+	}
+}
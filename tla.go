@@ -0,0 +1,460 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type TLAKind int
+
+const (
+	TLAInt        TLAKind = 0
+	TLABool       TLAKind = 1
+	TLAString     TLAKind = 2
+	TLAModelValue TLAKind = 3
+	TLASeq        TLAKind = 4
+	TLASet        TLAKind = 5
+	TLARecord     TLAKind = 6
+	TLAFunction   TLAKind = 7
+)
+
+// TLAValue is a value of a TLA+ state variable as printed by TLC. Sequences
+// and sets keep their elements in Elems. Records keep their field names in
+// Fields and functions their keys in Keys, with the corresponding values in
+// Elems. Functions over 1..N are printed by TLC as sequences and parsed as such.
+type TLAValue struct {
+	Kind   TLAKind
+	Int    int
+	Bool   bool
+	Str    string
+	Fields []string
+	Keys   []*TLAValue
+	Elems  []*TLAValue
+}
+
+// ParseTLCState parses the "/\ var = value" conjuncts of a TLC state into
+// typed values keyed by variable name.
+func ParseTLCState(repr string) (map[string]*TLAValue, error) {
+	state := make(map[string]*TLAValue)
+	for name, raw := range tlcStateVars(repr) {
+		value, err := ParseTLAValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing variable %s: %s", name, err)
+		}
+		state[name] = value
+	}
+	return state, nil
+}
+
+// tlcStateVars splits a TLC state representation into the raw values of its
+// variables, keyed by variable name.
+func tlcStateVars(repr string) map[string]string {
+	vars := make(map[string]string)
+	cur := ""
+	for _, line := range strings.Split(repr, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "/\\ ") {
+			trimmed = strings.TrimPrefix(trimmed, "/\\ ")
+			if idx := strings.Index(trimmed, " = "); idx > 0 {
+				cur = trimmed[:idx]
+				vars[cur] = trimmed[idx+3:]
+				continue
+			}
+		}
+		if cur != "" {
+			vars[cur] += " " + trimmed
+		}
+	}
+	return vars
+}
+
+// ParseTLAValue parses a single TLA+ value
+func ParseTLAValue(s string) (*TLAValue, error) {
+	p := &tlaParser{s: s}
+	v, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.s[p.pos:], p.pos)
+	}
+	return v, nil
+}
+
+type tlaParser struct {
+	s   string
+	pos int
+}
+
+func (p *tlaParser) skipSpace() {
+	for p.pos < len(p.s) && unicode.IsSpace(rune(p.s[p.pos])) {
+		p.pos++
+	}
+}
+
+// consume skips the token if it comes next
+func (p *tlaParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.s[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *tlaParser) expect(token string) error {
+	if !p.consume(token) {
+		return fmt.Errorf("expected %q at %d", token, p.pos)
+	}
+	return nil
+}
+
+func (p *tlaParser) parseValue() (*TLAValue, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) {
+		return nil, fmt.Errorf("unexpected end of value")
+	}
+	switch c := p.s[p.pos]; {
+	case strings.HasPrefix(p.s[p.pos:], "<<"):
+		p.pos += 2
+		elems, err := p.parseList(">>")
+		if err != nil {
+			return nil, err
+		}
+		return &TLAValue{Kind: TLASeq, Elems: elems}, nil
+	case c == '{':
+		p.pos++
+		elems, err := p.parseList("}")
+		if err != nil {
+			return nil, err
+		}
+		return &TLAValue{Kind: TLASet, Elems: elems}, nil
+	case c == '[':
+		p.pos++
+		return p.parseRecord()
+	case c == '(':
+		p.pos++
+		return p.parseParen()
+	case c == '"':
+		return p.parseString()
+	case c == '-' || (c >= '0' && c <= '9'):
+		return p.parseInt()
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '_' || unicode.IsLetter(rune(p.s[p.pos])) || unicode.IsDigit(rune(p.s[p.pos]))) {
+			p.pos++
+		}
+		ident := p.s[start:p.pos]
+		switch ident {
+		case "TRUE":
+			return &TLAValue{Kind: TLABool, Bool: true}, nil
+		case "FALSE":
+			return &TLAValue{Kind: TLABool, Bool: false}, nil
+		}
+		return &TLAValue{Kind: TLAModelValue, Str: ident}, nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at %d", c, p.pos)
+	}
+}
+
+// parseList parses comma separated values up to the closing token
+func (p *tlaParser) parseList(closing string) ([]*TLAValue, error) {
+	elems := make([]*TLAValue, 0)
+	if p.consume(closing) {
+		return elems, nil
+	}
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, v)
+		if p.consume(closing) {
+			return elems, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tlaParser) parseRecord() (*TLAValue, error) {
+	record := &TLAValue{Kind: TLARecord, Fields: make([]string, 0), Elems: make([]*TLAValue, 0)}
+	if p.consume("]") {
+		return record, nil
+	}
+	for {
+		field, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if field.Kind != TLAModelValue {
+			return nil, fmt.Errorf("invalid record field at %d", p.pos)
+		}
+		if err := p.expect("|->"); err != nil {
+			return nil, err
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		record.Fields = append(record.Fields, field.Str)
+		record.Elems = append(record.Elems, v)
+		if p.consume("]") {
+			return record, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseParen parses a function (k1 :> v1 @@ k2 :> v2) or a parenthesized value
+func (p *tlaParser) parseParen() (*TLAValue, error) {
+	first, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	if !p.consume(":>") {
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		return first, nil
+	}
+
+	function := &TLAValue{Kind: TLAFunction, Keys: make([]*TLAValue, 0), Elems: make([]*TLAValue, 0)}
+	key := first
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		function.Keys = append(function.Keys, key)
+		function.Elems = append(function.Elems, v)
+		if p.consume(")") {
+			return function, nil
+		}
+		if err := p.expect("@@"); err != nil {
+			return nil, err
+		}
+		if key, err = p.parseValue(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(":>"); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *tlaParser) parseString() (*TLAValue, error) {
+	var b strings.Builder
+	p.pos++
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\\' && p.pos+1 < len(p.s):
+			b.WriteByte(p.s[p.pos+1])
+			p.pos += 2
+		case c == '"':
+			p.pos++
+			return &TLAValue{Kind: TLAString, Str: b.String()}, nil
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return nil, fmt.Errorf("unterminated string")
+}
+
+func (p *tlaParser) parseInt() (*TLAValue, error) {
+	start := p.pos
+	if p.s[p.pos] == '-' {
+		p.pos++
+	}
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	i, err := strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return nil, fmt.Errorf("invalid integer at %d", start)
+	}
+
+	// Integer intervals a..b denote sets
+	if p.consume("..") {
+		p.skipSpace()
+		upper, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		set := &TLAValue{Kind: TLASet, Elems: make([]*TLAValue, 0)}
+		for n := i; n <= upper.Int; n++ {
+			set.Elems = append(set.Elems, &TLAValue{Kind: TLAInt, Int: n})
+		}
+		return set, nil
+	}
+	return &TLAValue{Kind: TLAInt, Int: i}, nil
+}
+
+// String prints the value in TLA+ syntax. Sets and functions are printed in a
+// canonical order, so equal values are printed the same.
+func (v *TLAValue) String() string {
+	if v == nil {
+		return ""
+	}
+	switch v.Kind {
+	case TLAInt:
+		return strconv.Itoa(v.Int)
+	case TLABool:
+		if v.Bool {
+			return "TRUE"
+		}
+		return "FALSE"
+	case TLAString:
+		return strconv.Quote(v.Str)
+	case TLAModelValue:
+		return v.Str
+	case TLASeq:
+		return "<<" + strings.Join(valueStrings(v.Elems), ", ") + ">>"
+	case TLASet:
+		elems := valueStrings(v.Elems)
+		sort.Strings(elems)
+		return "{" + strings.Join(elems, ", ") + "}"
+	case TLARecord:
+		fields := make([]string, len(v.Fields))
+		for i, f := range v.Fields {
+			fields[i] = f + " |-> " + v.Elems[i].String()
+		}
+		return "[" + strings.Join(fields, ", ") + "]"
+	case TLAFunction:
+		entries := make([]string, len(v.Keys))
+		for i, k := range v.Keys {
+			entries[i] = k.String() + " :> " + v.Elems[i].String()
+		}
+		sort.Strings(entries)
+		return "(" + strings.Join(entries, " @@ ") + ")"
+	default:
+		return ""
+	}
+}
+
+func valueStrings(values []*TLAValue) []string {
+	strs := make([]string, len(values))
+	for i, e := range values {
+		strs[i] = e.String()
+	}
+	return strs
+}
+
+// Text returns strings and model values without quotes and all other values in TLA+ syntax
+func (v *TLAValue) Text() string {
+	if v != nil && (v.Kind == TLAString || v.Kind == TLAModelValue) {
+		return v.Str
+	}
+	return v.String()
+}
+
+// Get returns the value of a function at the key, the element of a sequence
+// at the 1-based index or the field of a record.
+func (v *TLAValue) Get(key string) (*TLAValue, bool) {
+	if v == nil {
+		return nil, false
+	}
+	switch v.Kind {
+	case TLAFunction:
+		for i, k := range v.Keys {
+			if k.Text() == key {
+				return v.Elems[i], true
+			}
+		}
+	case TLASeq:
+		if i, err := strconv.Atoi(key); err == nil && i >= 1 && i <= len(v.Elems) {
+			return v.Elems[i-1], true
+		}
+	case TLARecord:
+		for i, f := range v.Fields {
+			if f == key {
+				return v.Elems[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Domain returns the keys of a function, the indices of a sequence or the fields of a record
+func (v *TLAValue) Domain() []string {
+	if v == nil {
+		return nil
+	}
+	switch v.Kind {
+	case TLAFunction:
+		keys := make([]string, len(v.Keys))
+		for i, k := range v.Keys {
+			keys[i] = k.Text()
+		}
+		return keys
+	case TLASeq:
+		keys := make([]string, len(v.Elems))
+		for i := range v.Elems {
+			keys[i] = strconv.Itoa(i + 1)
+		}
+		return keys
+	case TLARecord:
+		return v.Fields
+	}
+	return nil
+}
+
+// Len returns the number of elements of a sequence or set and the number of entries of a function or record
+func (v *TLAValue) Len() int {
+	if v == nil {
+		return 0
+	}
+	return len(v.Elems)
+}
+
+// MarshalJSON encodes sequences and sets as arrays and records and functions as objects
+func (v *TLAValue) MarshalJSON() ([]byte, error) {
+	switch v.Kind {
+	case TLAInt:
+		return json.Marshal(v.Int)
+	case TLABool:
+		return json.Marshal(v.Bool)
+	case TLAString, TLAModelValue:
+		return json.Marshal(v.Str)
+	case TLASeq, TLASet:
+		return json.Marshal(v.Elems)
+	case TLARecord, TLAFunction:
+		keys := v.Fields
+		if v.Kind == TLAFunction {
+			keys = v.Domain()
+		}
+		var b bytes.Buffer
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			kb, err := json.Marshal(k)
+			if err != nil {
+				return nil, err
+			}
+			eb, err := json.Marshal(v.Elems[i])
+			if err != nil {
+				return nil, err
+			}
+			b.Write(kb)
+			b.WriteByte(':')
+			b.Write(eb)
+		}
+		b.WriteByte('}')
+		return b.Bytes(), nil
+	default:
+		return []byte("null"), nil
+	}
+}
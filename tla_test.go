@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTLCState(t *testing.T) {
+	tests := []struct {
+		name  string
+		repr  string
+		want  map[string]string
+		kinds map[string]TLAKind
+	}{
+		{
+			name: "scalars",
+			repr: "/\\ currentTerm = -1\n/\\ leader = TRUE\n/\\ name = \"a \\\"b\\\"\"\n/\\ state = Follower",
+			want: map[string]string{
+				"currentTerm": "-1",
+				"leader":      "TRUE",
+				"name":        "\"a \\\"b\\\"\"",
+				"state":       "Follower",
+			},
+			kinds: map[string]TLAKind{
+				"currentTerm": TLAInt,
+				"leader":      TLABool,
+				"name":        TLAString,
+				"state":       TLAModelValue,
+			},
+		},
+		{
+			name:  "record",
+			repr:  "/\\ msg = [mtype |-> RequestVoteRequest, mterm |-> 2, msource |-> 1, mdest |-> 3]",
+			want:  map[string]string{"msg": "[mtype |-> RequestVoteRequest, mterm |-> 2, msource |-> 1, mdest |-> 3]"},
+			kinds: map[string]TLAKind{"msg": TLARecord},
+		},
+		{
+			name:  "function",
+			repr:  "/\\ votedFor = (n2 :> Nil @@ n1 :> n1 @@ n3 :> n1)",
+			want:  map[string]string{"votedFor": "(n1 :> n1 @@ n2 :> Nil @@ n3 :> n1)"},
+			kinds: map[string]TLAKind{"votedFor": TLAFunction},
+		},
+		{
+			name: "sequences",
+			repr: "/\\ log = <<<<>>, <<[term |-> 1, value |-> \"v\"]>>, <<>>>>\n/\\ nextIndex = <<1, 2, 3>>",
+			want: map[string]string{
+				"log":       "<<<<>>, <<[term |-> 1, value |-> \"v\"]>>, <<>>>>",
+				"nextIndex": "<<1, 2, 3>>",
+			},
+			kinds: map[string]TLAKind{"log": TLASeq, "nextIndex": TLASeq},
+		},
+		{
+			name:  "sets and intervals",
+			repr:  "/\\ votes = {3, 1, 2}\n/\\ servers = 1..3\n/\\ empty = {}",
+			want:  map[string]string{"votes": "{1, 2, 3}", "servers": "{1, 2, 3}", "empty": "{}"},
+			kinds: map[string]TLAKind{"votes": TLASet, "servers": TLASet, "empty": TLASet},
+		},
+		{
+			name: "nested bags",
+			repr: "/\\ messages = ( n1 :> ([mtype |-> AppendEntries, mterm |-> 1] :> 2 @@\n" +
+				"      [mtype |-> RequestVote, mterm |-> 1] :> 1) @@\n" +
+				"  n2 :> <<>> )",
+			want: map[string]string{
+				"messages": "(n1 :> ([mtype |-> AppendEntries, mterm |-> 1] :> 2 @@ [mtype |-> RequestVote, mterm |-> 1] :> 1) @@ n2 :> <<>>)",
+			},
+			kinds: map[string]TLAKind{"messages": TLAFunction},
+		},
+		{
+			name:  "parenthesized value",
+			repr:  "/\\ x = (<<1>>)",
+			want:  map[string]string{"x": "<<1>>"},
+			kinds: map[string]TLAKind{"x": TLASeq},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := ParseTLCState(tt.repr)
+			if err != nil {
+				t.Fatalf("ParseTLCState() error = %v", err)
+			}
+			if len(state) != len(tt.want) {
+				t.Fatalf("ParseTLCState() parsed %d variables, want %d", len(state), len(tt.want))
+			}
+			for name, want := range tt.want {
+				value, ok := state[name]
+				if !ok {
+					t.Fatalf("variable %s missing", name)
+				}
+				if got := value.String(); got != want {
+					t.Errorf("%s = %s, want %s", name, got, want)
+				}
+				if value.Kind != tt.kinds[name] {
+					t.Errorf("%s kind = %d, want %d", name, value.Kind, tt.kinds[name])
+				}
+			}
+		})
+	}
+}
+
+func TestParseTLCStateAccessors(t *testing.T) {
+	state, err := ParseTLCState("/\\ bag = ([a |-> 1] :> 2 @@ [a |-> 2] :> 1)\n/\\ log = <<(x :> 1), (y :> 2)>>\n/\\ rec = [f |-> {1, 2}]")
+	if err != nil {
+		t.Fatalf("ParseTLCState() error = %v", err)
+	}
+	if got := state["bag"].Len(); got != 2 {
+		t.Errorf("Len(bag) = %d, want 2", got)
+	}
+	if v, ok := state["bag"].Get("[a |-> 2]"); !ok || v.Int != 1 {
+		t.Errorf("bag[[a |-> 2]] = %v, %v, want 1", v, ok)
+	}
+	if v, ok := state["log"].Get("2"); !ok || v.String() != "(y :> 2)" {
+		t.Errorf("log[2] = %v, %v, want (y :> 2)", v, ok)
+	}
+	if _, ok := state["log"].Get("3"); ok {
+		t.Errorf("log[3] found, want out of range")
+	}
+	if got := strings.Join(state["rec"].Domain(), ","); got != "f" {
+		t.Errorf("DOMAIN rec = %s, want f", got)
+	}
+}
+
+func TestParseTLCStateMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		repr string
+	}{
+		{"unterminated sequence", "/\\ log = <<1, 2"},
+		{"unterminated set", "/\\ votes = {1, 2"},
+		{"missing separator", "/\\ votes = {1 2}"},
+		{"empty element", "/\\ votes = {1, , 2}"},
+		{"record without value", "/\\ msg = [mtype |-> ]"},
+		{"record with invalid field", "/\\ msg = [1 |-> 2]"},
+		{"function without value", "/\\ f = (1 :> 2 @@ 3)"},
+		{"unterminated function", "/\\ f = (1 :> 2"},
+		{"unterminated string", "/\\ s = \"abc"},
+		{"trailing input", "/\\ x = 1 2"},
+		{"unbalanced parenthesis", "/\\ x = (1"},
+		{"invalid token", "/\\ x = #"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := ParseTLCState(tt.repr)
+			if err == nil {
+				t.Fatalf("ParseTLCState() = %v, want error", state)
+			}
+			if state != nil {
+				t.Errorf("ParseTLCState() returned a partial state on error")
+			}
+		})
+	}
+}
@@ -20,6 +20,10 @@ type TLCClient struct {
 type TLCState struct {
 	Repr string
 	Key  int64
+	// Variables of the state parsed from Repr, nil if it could not be parsed
+	State map[string]*TLAValue `json:",omitempty"`
+	// Error parsing Repr
+	ParseError error `json:"-"`
 }
 
 func NewTLCClient(addr string) *TLCClient {
@@ -50,7 +54,8 @@ func (c *TLCClient) SendTrace(trace *EventTrace) ([]TLCState, error) {
 	}
 	result := make([]TLCState, len(tlcResponse.States))
 	for i, s := range tlcResponse.States {
-		result[i] = TLCState{Repr: s, Key: tlcResponse.Keys[i]}
+		state, err := ParseTLCState(s)
+		result[i] = TLCState{Repr: s, Key: tlcResponse.Keys[i], State: state, ParseError: err}
 	}
 	return result, nil
 }
\ No newline at end of file
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ModelStep is a single state of an abstract behaviour produced by TLC
+// together with the name of the action that led to it.
+type ModelStep struct {
+	Action string
+	Repr   string
+	State  map[string]*TLAValue
+}
+
+var tlcStateHeader = regexp.MustCompile(`^State (\d+): <(\w+)`)
+
+// parseTLCTraceFile reads behaviours in the textual format TLC uses for error
+// traces and simulation dumps, where every state is introduced by a line of
+// the form "State N: <Action line ...>" followed by the "/\ var = value"
+// conjuncts of the state. A new behaviour starts whenever N is 1.
+func parseTLCTraceFile(filePath string) ([][]ModelStep, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	traces := make([][]ModelStep, 0)
+	var cur []ModelStep
+	var lines []string
+	flush := func() {
+		if len(cur) > 0 && lines != nil {
+			step := &cur[len(cur)-1]
+			step.Repr = strings.TrimSpace(strings.Join(lines, "\n"))
+			step.State, _ = ParseTLCState(step.Repr)
+		}
+		lines = nil
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := tlcStateHeader.FindStringSubmatch(line); m != nil {
+			flush()
+			if m[1] == "1" {
+				if len(cur) > 0 {
+					traces = append(traces, cur)
+				}
+				cur = make([]ModelStep, 0)
+			}
+			cur = append(cur, ModelStep{Action: m[2]})
+			lines = make([]string, 0)
+			continue
+		}
+		if lines == nil {
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	if len(cur) > 0 {
+		traces = append(traces, cur)
+	}
+	return traces, scanner.Err()
+}
+
+// normalizeRepr collapses the whitespace of a TLC state representation so that
+// states printed by different TLC modes can be compared.
+func normalizeRepr(repr string) string {
+	return strings.Join(strings.Fields(repr), " ")
+}
+
+// nodeID maps a model value for a node, such as n2 or 2, to the node ID used by the cluster
+func nodeID(value string) string {
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+	return digits
+}
+
+// messageRecords returns the multiset of messages in the messages variable,
+// which is either a bag of messages or a set of messages
+func messageRecords(state map[string]*TLAValue) map[string]int {
+	records := make(map[string]int)
+	messages, ok := state["messages"]
+	if !ok {
+		return records
+	}
+	switch messages.Kind {
+	case TLAFunction:
+		for i, m := range messages.Keys {
+			if count := messages.Elems[i]; count.Kind == TLAInt {
+				records[m.String()] += count.Int
+			}
+		}
+	case TLASet, TLASeq:
+		for _, m := range messages.Elems {
+			records[m.String()]++
+		}
+	}
+	return records
+}
+
+// messageEnds returns the sender and receiver of a message record
+func messageEnds(record string) (string, string, bool) {
+	m, err := ParseTLAValue(record)
+	if err != nil {
+		return "", "", false
+	}
+	from, fok := m.Get("msource")
+	to, tok := m.Get("mdest")
+	if !fok || !tok {
+		return "", "", false
+	}
+	return nodeID(from.Text()), nodeID(to.Text()), true
+}
+
+// changedNode returns the node whose per-node variables changed the most between two states
+func changedNode(prev, cur map[string]*TLAValue) string {
+	changes := make(map[string]int)
+	for name, value := range cur {
+		if value.Kind != TLAFunction && value.Kind != TLASeq {
+			continue
+		}
+		for _, k := range value.Domain() {
+			v, _ := value.Get(k)
+			p, ok := prev[name].Get(k)
+			if !ok || p.String() != v.String() {
+				changes[nodeID(k)]++
+			}
+		}
+	}
+	best := ""
+	for n, c := range changes {
+		if n != "" && (best == "" || c > changes[best] || (c == changes[best] && n < best)) {
+			best = n
+		}
+	}
+	return best
+}
+
+// ModelGenerator translates abstract behaviours produced by TLC into
+// schedules. Behaviours are read from the trace files in TracesDir, which
+// TLC writes in simulation mode or when reporting counterexamples, and the
+// ones reaching the most states not yet visited by the fuzzer are used first.
+// Model steps are mapped to schedule steps: received messages become
+// deliveries between the sender and receiver, restarts become crashes and
+// client requests become client requests. The remainder of the horizon is
+// filled by the fallback generator, which is also used once no behaviour
+// reaches unvisited states.
+type ModelGenerator struct {
+	TracesDir string
+	fallback  Generator
+	visited   func(string) bool
+	loaded    map[string]bool
+	traces    [][]ModelStep
+	r         *rand.Rand
+}
+
+var _ Generator = &ModelGenerator{}
+
+func NewModelGenerator(tracesDir string, fallback Generator, visited func(string) bool, random *rand.Rand) *ModelGenerator {
+	return &ModelGenerator{
+		TracesDir: tracesDir,
+		fallback:  fallback,
+		visited:   visited,
+		loaded:    make(map[string]bool),
+		traces:    make([][]ModelStep, 0),
+		r:         random,
+	}
+}
+
+// load reads the trace files that appeared in the traces directory since the last call
+func (m *ModelGenerator) load() {
+	files, err := filepath.Glob(filepath.Join(m.TracesDir, "*"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		if m.loaded[file] {
+			continue
+		}
+		m.loaded[file] = true
+		traces, err := parseTLCTraceFile(file)
+		if err != nil {
+			continue
+		}
+		m.traces = append(m.traces, traces...)
+	}
+}
+
+func (m *ModelGenerator) unvisited(steps []ModelStep) int {
+	count := 0
+	for _, s := range steps {
+		if m.visited == nil || !m.visited(normalizeRepr(s.Repr)) {
+			count++
+		}
+	}
+	return count
+}
+
+func (m *ModelGenerator) Generate(params ScheduleParams) *Trace {
+	m.load()
+
+	best := -1
+	bestUnvisited := 0
+	for i, steps := range m.traces {
+		if u := m.unvisited(steps); u > bestUnvisited {
+			best = i
+			bestUnvisited = u
+		}
+	}
+	if best == -1 {
+		return m.fallback.Generate(params)
+	}
+	steps := m.traces[best]
+	m.traces = append(m.traces[:best], m.traces[best+1:]...)
+
+	trace := m.translate(steps)
+	length := trace.Horizon
+	if params.Horizon > length {
+		trace.Horizon = params.Horizon
+		for _, ch := range m.fallback.Generate(params).Choices {
+			if ch.Step >= length {
+				trace.Add(ch)
+			}
+		}
+	}
+	trace.Params = &params
+	return trace
+}
+
+func (m *ModelGenerator) translate(steps []ModelStep) *Trace {
+	trace := NewTrace()
+	step := 0
+	for i := 1; i < len(steps); i++ {
+		prev := steps[i-1].State
+		cur := steps[i].State
+		action := steps[i].Action
+
+		switch {
+		case strings.Contains(action, "Restart") || strings.Contains(action, "Crash"):
+			if node := changedNode(prev, cur); node != "" {
+				trace.Add(Choice{
+					Type: "Crash",
+					Node: node,
+					Step: step,
+				})
+			}
+		case strings.Contains(action, "ClientRequest"):
+			trace.Add(Choice{
+				Type: "ClientRequest",
+				Op:   "write",
+				Step: step,
+			})
+		case strings.Contains(action, "Receive") || strings.HasPrefix(action, "Handle"):
+			prevRecords := messageRecords(prev)
+			curRecords := messageRecords(cur)
+			for record, count := range prevRecords {
+				if curRecords[record] >= count {
+					continue
+				}
+				from, to, ok := messageEnds(record)
+				if !ok {
+					continue
+				}
+				trace.Add(Choice{
+					Type:        "Node",
+					Step:        step,
+					From:        from,
+					To:          to,
+					MaxMessages: 1,
+				})
+				break
+			}
+		}
+		// Local actions such as timeouts are left to the implementation, the
+		// step only lets time pass
+		step++
+	}
+	trace.Horizon = step
+	return trace
+}
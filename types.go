@@ -24,15 +24,28 @@ func (c Choice) Copy() Choice {
 
 type Trace struct {
 	Choices []Choice
+	// Number of steps the trace is executed for
+	Horizon int
+	// Parameters the trace, or the seed it was mutated from, was generated with
+	Params *ScheduleParams `json:",omitempty"`
+	// Mutators that were applied to the parent trace to obtain this trace
+	Mutators []string `json:",omitempty"`
+	// Strategy that scored the parent trace
+	Strategy string `json:",omitempty"`
 }
 
 func (t *Trace) Copy() *Trace {
 	new := &Trace{
-		Choices: make([]Choice, len(t.Choices)),
+		Choices:  make([]Choice, len(t.Choices)),
+		Horizon:  t.Horizon,
+		Params:   t.Params,
+		Mutators: make([]string, len(t.Mutators)),
+		Strategy: t.Strategy,
 	}
 	for i, ch := range t.Choices {
 		new.Choices[i] = ch.Copy()
 	}
+	copy(new.Mutators, t.Mutators)
 	return new
 }
 
@@ -46,11 +59,28 @@ func (t *Trace) Add(ch Choice) {
 	t.Choices = append(t.Choices, ch.Copy())
 }
 
+// Steps returns the horizon of the trace. For traces without an explicit
+// horizon it is the number of steps covered by the choices.
+func (t *Trace) Steps() int {
+	if t.Horizon > 0 {
+		return t.Horizon
+	}
+	steps := 0
+	for _, ch := range t.Choices {
+		if ch.Step+1 > steps {
+			steps = ch.Step + 1
+		}
+	}
+	return steps
+}
+
 type Event struct {
 	Name   string
 	Node   string `json:"-"`
 	Params map[string]interface{}
 	Reset  bool
+	// Step of the schedule during which the event was observed
+	Step int `json:"-"`
 }
 
 func (e Event) Copy() Event {
@@ -59,6 +89,7 @@ func (e Event) Copy() Event {
 		Node:   e.Node,
 		Params: make(map[string]interface{}),
 		Reset:  e.Reset,
+		Step:   e.Step,
 	}
 	for k, v := range e.Params {
 		new.Params[k] = v
@@ -107,4 +138,60 @@ type Stats struct {
 	CodeCoverage  []int
 	RandomTraces  int
 	MutatedTraces int
+	MutatorStats  map[string]*MutatorStat
+	SwarmStats    map[string]*SwarmStat `json:",omitempty"`
+	// Closest distance to each target predicate after every iteration, -1 until a state was checked
+	TargetDistances map[string][]float64 `json:",omitempty"`
+	// First iteration at which each target predicate was reached
+	TargetHits map[string]int `json:",omitempty"`
+	// Time to the first hit of each code target
+	CodeTargetHits map[string]*TargetHit `json:",omitempty"`
+	// Strategy active at every iteration
+	ActiveStrategies []string
+	// Number of abstract states reached after every iteration, per abstraction
+	AbstractCoverages map[string][]int `json:",omitempty"`
+	// Number of distinct values of each TLA+ variable after every iteration
+	VariableValues map[string][]int
+	// Largest value of each integer valued TLA+ variable after every iteration
+	VariableMaxima map[string][]int
+	// Number of times each action was exercised after every iteration
+	ActionCounts map[string][]int
+	// Number of distinct pairs of consecutive actions after every iteration
+	ActionPairs []int
+	// Chao1 estimate of the total number of states after every iteration
+	EstimatedCoverages []float64
+	// Iteration at which the campaign stopped because state discovery plateaued
+	StoppedAt int `json:",omitempty"`
+	// Number of code coverage probes hit by the schedule of every iteration
+	ScheduleProbes []int
+	// Iteration that first covered each line, keyed by file:line
+	LineAttribution map[string]int
+	// Number of covered branches after every iteration
+	BranchCoverage []int
+}
+
+type TargetHit struct {
+	Iteration int
+	Seconds   float64
+}
+
+// SwarmStat records how productive the schedules of a swarm feature combination were
+type SwarmStat struct {
+	Schedules      int
+	Successes      int
+	NewStates      int
+	NewTransitions int
+	NewLines       int
+	NewBranches    int
+}
+
+// MutatorStat records how productive the mutants of a mutator were
+type MutatorStat struct {
+	Generated      int
+	Executed       int
+	Successes      int
+	NewStates      int
+	NewTransitions int
+	NewLines       int
+	NewBranches    int
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"math"
 	"math/rand"
 )
 
@@ -28,4 +29,36 @@ func intRange(start, end int) []int {
 		res[i-start] = i
 	}
 	return res
-}
\ No newline at end of file
+}
+
+// sampleBeta draws a sample from the Beta(a, b) distribution.
+func sampleBeta(a, b float64, r *rand.Rand) float64 {
+	x := sampleGamma(a, r)
+	y := sampleGamma(b, r)
+	if x+y == 0 {
+		return 0
+	}
+	return x / (x + y)
+}
+
+// sampleGamma draws a sample from the Gamma(a, 1) distribution using the
+// Marsaglia-Tsang method.
+func sampleGamma(a float64, r *rand.Rand) float64 {
+	if a < 1 {
+		return sampleGamma(a+1, r) * math.Pow(r.Float64(), 1/a)
+	}
+	d := a - 1.0/3.0
+	c := 1 / math.Sqrt(9*d)
+	for {
+		x := r.NormFloat64()
+		v := 1 + c*x
+		if v <= 0 {
+			continue
+		}
+		v = v * v * v
+		u := r.Float64()
+		if math.Log(u) < 0.5*x*x+d-d*v+d*math.Log(v) {
+			return d * v
+		}
+	}
+}
@@ -51,18 +51,7 @@ func (x *XraftNode) Create() {
 
 	x.process = exec.Command("bash", serverArgs...)
 	x.process.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
-	env := os.Environ()
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		x.logger.Debug("Failed to get current working directory")
-	} else {
-		x.logger.Debug("Current working directory: " + cwd)
-	}
-	jacocoFile := fmt.Sprintf("%s/output/modelfuzz/jacoco/jacocoRun.exec", cwd)
-	jacocoEnv := fmt.Sprintf("-javaagent:%s/jacocoagent.jar=output=file,destfile=%s,append=true,dumponexit=true", cwd, jacocoFile)
-	env = append(env, "JAVA_TOOL_OPTIONS="+jacocoEnv)
-	x.process.Env = env
+	x.process.Env = javaEnv(x.config.JavaToolOptions)
 
 	if x.stdout == nil {
 		x.stdout = new(bytes.Buffer)
@@ -132,12 +121,14 @@ type XraftClient struct {
 	BaseServicePort int
 	logger          *Logger
 	NumNodes        int
+	JavaToolOptions string
 }
 
-func NewXraftClient(numNodes int, baseServicePort int, clientBinary string, logger *Logger) *XraftClient {
+func NewXraftClient(numNodes int, baseServicePort int, clientBinary string, javaToolOptions string, logger *Logger) *XraftClient {
 	return &XraftClient{
 		BaseServicePort: baseServicePort,
 		ClientBinary:    clientBinary,
+		JavaToolOptions: javaToolOptions,
 		logger:          logger,
 		NumNodes:        numNodes,
 	}
@@ -154,18 +145,7 @@ func (c *XraftClient) SendRequest() {
 	}
 
 	process := exec.Command("bash", clientArgs...)
-	env := os.Environ()
-
-	cwd, err := os.Getwd()
-	if err != nil {
-		c.logger.Debug("Failed to get current working directory")
-	} else {
-		c.logger.Debug("Current working directory: " + cwd)
-	}
-	jacocoFile := fmt.Sprintf("%s/output/modelfuzz/jacoco/jacocoRun.exec", cwd)
-	jacocoEnv := fmt.Sprintf("-javaagent:%s/jacocoagent.jar=output=file,destfile=%s,append=true,dumponexit=true", cwd, jacocoFile)
-	env = append(env, "JAVA_TOOL_OPTIONS="+jacocoEnv)
-	process.Env = env
+	process.Env = javaEnv(c.JavaToolOptions)
 
 	process.Start()
 